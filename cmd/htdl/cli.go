@@ -5,13 +5,37 @@ import (
 	"fmt"
 	"log/slog"
 	"maps"
+	"os"
 	"slices"
 	"strings"
+
+	"github.com/danielrenes/htdl/internal/htdl"
+	"github.com/danielrenes/htdl/internal/text"
+	"github.com/danielrenes/htdl/internal/transform"
 )
 
 type args struct {
-	LogLevel slog.Level
-	Links    []string
+	LogLevel       slog.Level
+	Format         htdl.Format
+	TextWidth      int
+	OutputTemplate string
+	Exists         htdl.ExistsPolicy
+	Output         string
+	Compression    htdl.Compression
+	Manifest       bool
+	Styles         transform.StyleOptions
+	Images         transform.ImageOptions
+	Media          transform.MediaOptions
+	PruneCSS       transform.PruneMode
+	SVGImages      bool
+	MetaImages     bool
+	Embeds         bool
+	EmbedRules     []transform.EmbedRule
+	Icons          bool
+	IconSize       int
+	PruneFonts     bool
+	MinifyCSS      bool
+	Links          []string
 }
 
 func parseArgs() (*args, error) {
@@ -19,11 +43,148 @@ func parseArgs() (*args, error) {
 	for _, lvl := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
 		logLevels[strings.ToLower(lvl.String())] = lvl
 	}
+	formats := make(map[string]htdl.Format, 0)
+	for _, format := range []htdl.Format{htdl.FormatHTML, htdl.FormatText} {
+		formats[format.String()] = format
+	}
+	compressions := make(map[string]htdl.Compression, 0)
+	for _, c := range []htdl.Compression{htdl.CompressionNone, htdl.CompressionGzip, htdl.CompressionSelfExtracting} {
+		compressions[c.String()] = c
+	}
+	stylesheetPolicies := make(map[string]transform.StylesheetPolicy, 0)
+	for _, policy := range []transform.StylesheetPolicy{transform.StylesheetDrop, transform.StylesheetInline} {
+		stylesheetPolicies[policy.String()] = policy
+	}
+	pruneModes := make(map[string]transform.PruneMode, 0)
+	for _, mode := range []transform.PruneMode{transform.PruneNone, transform.PruneConservative, transform.PruneStrict} {
+		pruneModes[mode.String()] = mode
+	}
+	picturePolicies := make(map[string]transform.PicturePolicy, 0)
+	for _, policy := range []transform.PicturePolicy{transform.PictureCollapse, transform.PictureInline} {
+		picturePolicies[policy.String()] = policy
+	}
+	mediaPolicies := make(map[string]transform.MediaPolicy, 0)
+	for _, policy := range []transform.MediaPolicy{transform.MediaLink, transform.MediaPoster, transform.MediaInline} {
+		mediaPolicies[policy.String()] = policy
+	}
+	existsPolicies := make(map[string]htdl.ExistsPolicy, 0)
+	for _, policy := range []htdl.ExistsPolicy{htdl.ExistsSuffix, htdl.ExistsOverwrite, htdl.ExistsSkip} {
+		existsPolicies[policy.String()] = policy
+	}
 	logLevel := flag.String(
 		"log-level",
 		strings.ToLower(slog.LevelInfo.String()),
 		fmt.Sprintf("The log level. Choices: %v", slices.Collect(maps.Keys(logLevels))),
 	)
+	format := flag.String(
+		"format",
+		htdl.FormatHTML.String(),
+		fmt.Sprintf("The output format. Choices: %v", slices.Collect(maps.Keys(formats))),
+	)
+	textWidth := flag.Int("text-width", text.DefaultWidth, "The line width of the text output format.")
+	outputTemplate := flag.String(
+		"output-template",
+		htdl.DefaultOutputTemplate,
+		"The output filename template without extension. Fields: {title}, {host}, {path}, {date}, {hash}",
+	)
+	exists := flag.String(
+		"exists",
+		htdl.ExistsSuffix.String(),
+		fmt.Sprintf("What to do when the output file exists. Choices: %v", slices.Collect(maps.Keys(existsPolicies))),
+	)
+	compression := flag.String(
+		"compress",
+		htdl.CompressionNone.String(),
+		fmt.Sprintf("The output compression. Choices: %v", slices.Collect(maps.Keys(compressions))),
+	)
+	alternateStylesheets := flag.String(
+		"alternate-stylesheets",
+		transform.StylesheetDrop.String(),
+		fmt.Sprintf("What to do with alternate stylesheets. Choices: %v", slices.Collect(maps.Keys(stylesheetPolicies))),
+	)
+	disabledStylesheets := flag.String(
+		"disabled-stylesheets",
+		transform.StylesheetDrop.String(),
+		fmt.Sprintf("What to do with disabled stylesheets. Choices: %v", slices.Collect(maps.Keys(stylesheetPolicies))),
+	)
+	pruneCSS := flag.String(
+		"prune-css",
+		transform.PruneNone.String(),
+		fmt.Sprintf("Remove the CSS rules matching no element. Choices: %v", slices.Collect(maps.Keys(pruneModes))),
+	)
+	fontFormats := flag.String(
+		"font-formats",
+		strings.Join(transform.DefaultFontFormats, ","),
+		"The preferred @font-face source formats in order, only the first available is inlined.",
+	)
+	imageSetDensity := flag.Float64(
+		"image-set-density",
+		0,
+		"Inline the image-set() candidate with the lowest density not below this one, 0 selects the highest density.",
+	)
+	imageCandidate := flag.String(
+		"image-candidate",
+		transform.CandidatePolicy{}.String(),
+		"The srcset candidate to inline: largest, smallest, the closest to a width like 640w or to a density like 2x.",
+	)
+	imageCandidates := flag.Int(
+		"image-candidates",
+		1,
+		"The number of srcset candidates kept as data URLs, in order of preference.",
+	)
+	imageTypes := flag.String(
+		"image-types",
+		strings.Join(transform.DefaultImageTypes, ","),
+		"The supported image types the picture sources are selected from.",
+	)
+	picture := flag.String(
+		"picture",
+		transform.PictureCollapse.String(),
+		fmt.Sprintf("What to do with the sources of picture elements. Choices: %v", slices.Collect(maps.Keys(picturePolicies))),
+	)
+	maxImageWidth := flag.Int(
+		"max-image-width",
+		0,
+		"Downscale the PNG, JPEG and GIF images wider than this, 0 keeps every size.",
+	)
+	jpegQuality := flag.Int(
+		"jpeg-quality",
+		0,
+		fmt.Sprintf(
+			"Re-encode the JPEG images with this quality, 0 keeps the originals unless downscaled, which use %d.",
+			transform.DefaultJPEGQuality,
+		),
+	)
+	lazyAttributes := flag.String(
+		"lazy-attributes",
+		strings.Join(transform.DefaultLazyAttributes, ","),
+		"The attributes holding the URLs of lazy loaded images, the ones ending in srcset hold a srcset.",
+	)
+	video := flag.String(
+		"video",
+		transform.MediaLink.String(),
+		fmt.Sprintf("What to do with video elements. Choices: %v", slices.Collect(maps.Keys(mediaPolicies))),
+	)
+	audio := flag.String(
+		"audio",
+		transform.MediaLink.String(),
+		fmt.Sprintf("What to do with audio elements. Choices: %v", []transform.MediaPolicy{transform.MediaLink, transform.MediaInline}),
+	)
+	maxMediaSize := flag.Int("max-media-size", transform.DefaultMaxMediaSize, "The size in bytes of the largest media file inlined.")
+	svgImages := flag.Bool("svg-images", false, "Inline the SVG images as svg elements instead of data URLs.")
+	metaImages := flag.Bool("meta-images", false, "Inline the Open Graph, Twitter card and schema.org images of the page.")
+	embeds := flag.Bool("embeds", false, "Replace the YouTube, Vimeo, map and social post embeds with static cards.")
+	embedRules := flag.String("embed-rules", "", "A JSON file of embed rules applied before the default ones.")
+	icons := flag.Bool("icons", false, "Inline the icon of the page, or /favicon.ico if it declares none.")
+	iconSize := flag.Int("icon-size", 0, "Inline the smallest icon at least this large, 0 selects the largest.")
+	pruneFonts := flag.Bool("prune-fonts", false, "Remove the @font-face rules no text of the page is rendered with.")
+	minifyCSS := flag.Bool("minify-css", false, "Minify the inlined styles.")
+	manifest := flag.Bool("manifest", false, "Write a JSON manifest of the archived resources next to the output.")
+	output := flag.String(
+		"o",
+		"",
+		"Write the archive to this path instead of a templated name in the current directory. Use - for stdout.",
+	)
 	flag.Parse()
 	args := args{}
 	if lvl, ok := logLevels[*logLevel]; ok {
@@ -31,6 +192,137 @@ func parseArgs() (*args, error) {
 	} else {
 		return nil, fmt.Errorf("invalid log level %s", *logLevel)
 	}
+	if f, ok := formats[*format]; ok {
+		args.Format = f
+	} else {
+		return nil, fmt.Errorf("invalid format %s", *format)
+	}
+	if *textWidth <= 0 {
+		return nil, fmt.Errorf("invalid text width %d", *textWidth)
+	}
+	args.TextWidth = *textWidth
+	args.OutputTemplate = *outputTemplate
+	if policy, ok := existsPolicies[*exists]; ok {
+		args.Exists = policy
+	} else {
+		return nil, fmt.Errorf("invalid exists policy %s", *exists)
+	}
+	if c, ok := compressions[*compression]; ok {
+		args.Compression = c
+	} else {
+		return nil, fmt.Errorf("invalid compression %s", *compression)
+	}
+	if args.Compression == htdl.CompressionSelfExtracting && args.Format != htdl.FormatHTML {
+		return nil, fmt.Errorf("%s compression requires the %s format", args.Compression, htdl.FormatHTML)
+	}
+	if policy, ok := stylesheetPolicies[*alternateStylesheets]; ok {
+		args.Styles.Alternate = policy
+	} else {
+		return nil, fmt.Errorf("invalid alternate stylesheet policy %s", *alternateStylesheets)
+	}
+	if policy, ok := stylesheetPolicies[*disabledStylesheets]; ok {
+		args.Styles.Disabled = policy
+	} else {
+		return nil, fmt.Errorf("invalid disabled stylesheet policy %s", *disabledStylesheets)
+	}
+	for _, format := range strings.Split(*fontFormats, ",") {
+		if format = strings.TrimSpace(format); len(format) > 0 {
+			args.Styles.FontFormats = append(args.Styles.FontFormats, strings.ToLower(format))
+		}
+	}
+	if *imageSetDensity < 0 {
+		return nil, fmt.Errorf("invalid image-set density %g", *imageSetDensity)
+	}
+	args.Styles.ImageSetDensity = *imageSetDensity
+	policy, err := transform.ParseCandidatePolicy(*imageCandidate)
+	if err != nil {
+		return nil, err
+	}
+	args.Images.Candidate = policy
+	if *imageCandidates <= 0 {
+		return nil, fmt.Errorf("invalid number of image candidates %d", *imageCandidates)
+	}
+	args.Images.Candidates = *imageCandidates
+	for _, typ := range strings.Split(*imageTypes, ",") {
+		if typ = strings.TrimSpace(typ); len(typ) > 0 {
+			args.Images.Types = append(args.Images.Types, strings.ToLower(typ))
+		}
+	}
+	if *maxImageWidth < 0 {
+		return nil, fmt.Errorf("invalid max image width %d", *maxImageWidth)
+	}
+	args.Images.MaxWidth = *maxImageWidth
+	if *jpegQuality < 0 || *jpegQuality > 100 {
+		return nil, fmt.Errorf("invalid JPEG quality %d", *jpegQuality)
+	}
+	args.Images.JPEGQuality = *jpegQuality
+	for _, attr := range strings.Split(*lazyAttributes, ",") {
+		if attr = strings.TrimSpace(attr); len(attr) > 0 {
+			args.Images.LazyAttributes = append(args.Images.LazyAttributes, strings.ToLower(attr))
+		}
+	}
+	if policy, ok := picturePolicies[*picture]; ok {
+		args.Images.Picture = policy
+	} else {
+		return nil, fmt.Errorf("invalid picture policy %s", *picture)
+	}
+	if policy, ok := mediaPolicies[*video]; ok {
+		args.Media.Video = policy
+	} else {
+		return nil, fmt.Errorf("invalid video policy %s", *video)
+	}
+	if policy, ok := mediaPolicies[*audio]; ok && policy != transform.MediaPoster {
+		args.Media.Audio = policy
+	} else {
+		return nil, fmt.Errorf("invalid audio policy %s", *audio)
+	}
+	if *maxMediaSize <= 0 {
+		return nil, fmt.Errorf("invalid max media size %d", *maxMediaSize)
+	}
+	args.Media.MaxSize = *maxMediaSize
+	args.SVGImages = *svgImages
+	args.MetaImages = *metaImages
+	args.Embeds = *embeds
+	if len(*embedRules) > 0 {
+		data, err := os.ReadFile(*embedRules)
+		if err != nil {
+			return nil, fmt.Errorf("read embed rules: %w", err)
+		}
+		rules, err := transform.ParseEmbedRules(data)
+		if err != nil {
+			return nil, err
+		}
+		args.EmbedRules = rules
+	}
+	args.Icons = *icons
+	if *iconSize < 0 {
+		return nil, fmt.Errorf("invalid icon size %d", *iconSize)
+	}
+	args.IconSize = *iconSize
+	if mode, ok := pruneModes[*pruneCSS]; ok {
+		args.PruneCSS = mode
+	} else {
+		return nil, fmt.Errorf("invalid prune mode %s", *pruneCSS)
+	}
+	if args.PruneCSS != transform.PruneNone && args.Format != htdl.FormatHTML {
+		return nil, fmt.Errorf("-prune-css requires the %s format", htdl.FormatHTML)
+	}
+	args.PruneFonts = *pruneFonts
+	if args.PruneFonts && args.Format != htdl.FormatHTML {
+		return nil, fmt.Errorf("-prune-fonts requires the %s format", htdl.FormatHTML)
+	}
+	args.MinifyCSS = *minifyCSS
+	if args.MinifyCSS && args.Format != htdl.FormatHTML {
+		return nil, fmt.Errorf("-minify-css requires the %s format", htdl.FormatHTML)
+	}
+	args.Manifest = *manifest
+	args.Output = *output
+	if args.Manifest && args.Output == "-" {
+		return nil, fmt.Errorf("-manifest cannot be used when writing to stdout")
+	}
 	args.Links = flag.Args()
+	if len(args.Output) > 0 && len(args.Links) != 1 {
+		return nil, fmt.Errorf("-o accepts a single link, got %d", len(args.Links))
+	}
 	return &args, nil
 }
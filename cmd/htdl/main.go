@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
@@ -11,18 +12,41 @@ import (
 )
 
 func run(args *args) error {
-	logger := slog.New(NewSlogHandler(os.Stdout, &slog.HandlerOptions{
+	logger := slog.New(NewSlogHandler(os.Stderr, &slog.HandlerOptions{
 		AddSource: true,
 		Level:     args.LogLevel,
 	}))
 	slog.SetDefault(logger)
+	opts := &htdl.Options{
+		Format:         args.Format,
+		TextWidth:      args.TextWidth,
+		OutputTemplate: args.OutputTemplate,
+		Exists:         args.Exists,
+		Compression:    args.Compression,
+		Manifest:       args.Manifest,
+		Styles:         args.Styles,
+		Images:         args.Images,
+		Media:          args.Media,
+		PruneCSS:       args.PruneCSS,
+		SVGImages:      args.SVGImages,
+		MetaImages:     args.MetaImages,
+		Embeds:         args.Embeds,
+		EmbedRules:     args.EmbedRules,
+		Icons:          args.Icons,
+		IconSize:       args.IconSize,
+		PruneFonts:     args.PruneFonts,
+		MinifyCSS:      args.MinifyCSS,
+	}
+	if len(args.Output) > 0 {
+		return writeOutput(args.Output, args.Links[0], opts)
+	}
 	cwd, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("get current working directory: %w", err)
 	}
 	errs := make([]error, 0)
 	for _, link := range args.Links {
-		if err := htdl.Archive(cwd, link); err != nil {
+		if err := htdl.Archive(cwd, link, opts); err != nil {
 			slog.Warn(fmt.Sprintf("Error downloading %s", link), slog.String("error", err.Error()))
 			errs = append(errs, err)
 		}
@@ -30,6 +54,35 @@ func run(args *args) error {
 	return errors.Join(errs...)
 }
 
+func writeOutput(path string, link string, opts *htdl.Options) error {
+	if path == "-" {
+		return htdl.WriteArchive(os.Stdout, link, opts)
+	}
+	manifest := &bytes.Buffer{}
+	if opts.Manifest {
+		if htdl.ManifestPath(path) == path {
+			return fmt.Errorf("the manifest of %s would overwrite it", path)
+		}
+		opts.ManifestWriter = manifest
+	}
+	fp, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", path, err)
+	}
+	if err := htdl.WriteArchive(fp, link, opts); err != nil {
+		_ = fp.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	if err := fp.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", path, err)
+	}
+	if opts.Manifest {
+		return htdl.SaveManifest(path, manifest.Bytes(), opts.Exists)
+	}
+	return nil
+}
+
 func main() {
 	args, err := parseArgs()
 	if err != nil {
@@ -0,0 +1,97 @@
+package css
+
+import "strings"
+
+// Declaration is a property declaration of a style rule or a style
+// attribute.
+type Declaration struct {
+	// Name is the property name as it appears in the source.
+	Name string
+	// Value holds the trimmed tokens of the value without the !important
+	// flag.
+	Value []Token
+	// Important reports whether the declaration is flagged !important.
+	Important bool
+}
+
+// Is reports whether the declaration sets the property, ignoring ASCII
+// case. Custom properties are case-sensitive.
+func (d *Declaration) Is(name string) bool {
+	if strings.HasPrefix(d.Name, "--") {
+		return d.Name == name
+	}
+	return strings.EqualFold(d.Name, name)
+}
+
+// ParseDeclarations parses the declarations of a block or a style
+// attribute. Nested rules and at-rules in the block are skipped, as are
+// malformed declarations.
+func ParseDeclarations(tokens []Token) []*Declaration {
+	declarations := make([]*Declaration, 0)
+	for i := 0; i < len(tokens); {
+		switch tokens[i].Type {
+		case Whitespace, Comment, Semicolon:
+			i++
+			continue
+		}
+		end, nested := declarationEnd(tokens, i)
+		if !nested && tokens[i].Type == Ident {
+			if d, ok := parseDeclaration(tokens[i:end]); ok {
+				declarations = append(declarations, d)
+			}
+		}
+		i = end + 1
+	}
+	return declarations
+}
+
+// ParseNestedRules parses the nested rules and at-rules of a block,
+// skipping its declarations.
+func ParseNestedRules(tokens []Token) []*Rule {
+	rules := make([]*Rule, 0)
+	for i := 0; i < len(tokens); {
+		switch tokens[i].Type {
+		case Whitespace, Comment, Semicolon:
+			i++
+			continue
+		}
+		end, nested := declarationEnd(tokens, i)
+		if nested {
+			rules = append(rules, ParseRules(tokens[i:min(end+1, len(tokens))]).Rules...)
+		}
+		i = end + 1
+	}
+	return rules
+}
+
+// declarationEnd returns the index of the semicolon ending the declaration
+// at tokens[i], or the closing brace of the block if it is a nested rule.
+func declarationEnd(tokens []Token, i int) (int, bool) {
+	for i < len(tokens) {
+		switch tokens[i].Type {
+		case Semicolon:
+			return i, false
+		case LeftBrace:
+			return matchingEnd(tokens, i), true
+		case LeftParen, LeftBracket, Function:
+			i = matchingEnd(tokens, i)
+		}
+		i++
+	}
+	return len(tokens), false
+}
+
+func parseDeclaration(tokens []Token) (*Declaration, bool) {
+	rest := Trim(tokens[1:])
+	if len(rest) == 0 || rest[0].Type != Colon {
+		return nil, false
+	}
+	d := &Declaration{Name: tokens[0].Value, Value: Trim(rest[1:])}
+	if n := len(d.Value); n >= 2 && d.Value[n-1].Is(Ident, "important") {
+		if value := Trim(d.Value[:n-1]); len(value) > 0 && value[len(value)-1].Is(Delim, "!") {
+			d.Value = Trim(value[:len(value)-1])
+			d.Important = true
+		}
+	}
+	return d, true
+}
@@ -0,0 +1,289 @@
+package css
+
+import (
+	"slices"
+	"strings"
+)
+
+// declarationAtRules are the at-rules whose blocks hold declarations
+// rather than rules.
+var declarationAtRules = []string{
+	"font-face", "page", "property", "counter-style", "font-palette-values", "viewport", "-ms-viewport",
+}
+
+// ruleListAtRules are the at-rules whose blocks hold rules the minifier
+// knows. The blocks of other at-rules may hold declarations, so they are
+// kept as they are.
+var ruleListAtRules = []string{
+	"media", "supports", "layer", "container", "scope", "document", "-moz-document", "starting-style",
+	"keyframes", "-webkit-keyframes", "-moz-keyframes", "-o-keyframes",
+}
+
+var lengthUnits = []string{
+	"px", "em", "rem", "ex", "rex", "ch", "rch", "cap", "rcap", "ic", "ric", "lh", "rlh",
+	"vw", "vh", "vi", "vb", "vmin", "vmax", "svw", "svh", "lvw", "lvh", "dvw", "dvh",
+	"cqw", "cqh", "cqi", "cqb", "cqmin", "cqmax",
+	"cm", "mm", "q", "in", "pt", "pc",
+}
+
+// unitlessZeroExceptions are the properties where a number has a different
+// meaning than a length, so zero lengths must keep their unit.
+var unitlessZeroExceptions = []string{"flex", "-webkit-flex", "-ms-flex"}
+
+var (
+	whitespace = Token{Type: Whitespace, Value: " ", Raw: " "}
+	colon      = Token{Type: Colon, Value: ":", Raw: ":"}
+	semicolon  = Token{Type: Semicolon, Value: ";", Raw: ";"}
+)
+
+// Minify returns the stylesheet without comments and redundant
+// whitespace, with shortened hex colors and unitless zero lengths, and
+// without @font-face rules directly repeating the previous rule. The custom
+// property values, the @charset rule and the blocks of unknown at-rules are
+// kept as they are.
+func Minify(s string) string {
+	return Serialize(separate(minifyRules(Parse(s).Rules)))
+}
+
+func minifyRules(rules []*Rule) []Token {
+	tokens := make([]Token, 0)
+	// Only a repetition of the previous rule is dropped, a duplicate after
+	// another face could decide which of the faces wins.
+	last := ""
+	for _, rule := range rules {
+		minified := minifyRule(rule)
+		key := Serialize(minified)
+		if rule.Is("font-face") && key == last {
+			continue
+		}
+		last = key
+		tokens = append(tokens, minified...)
+	}
+	return tokens
+}
+
+func minifyRule(rule *Rule) []Token {
+	minified := &Rule{AtKeyword: rule.AtKeyword, HasBlock: rule.HasBlock, atToken: rule.atToken}
+	if rule.Is("charset") {
+		minified.Prelude = rule.Prelude
+		return minified.Tokens()
+	}
+	if len(rule.AtKeyword) > 0 {
+		minified.Prelude = compact(rule.Prelude, preludeDroppable)
+		if len(minified.Prelude) > 0 && needsSeparator(Token{Type: AtKeyword}, minified.Prelude[0]) {
+			minified.Prelude = append([]Token{whitespace}, minified.Prelude...)
+		}
+	} else {
+		minified.Prelude = compact(rule.Prelude, selectorDroppable)
+	}
+	if rule.HasBlock {
+		switch {
+		case len(rule.AtKeyword) == 0 || slices.ContainsFunc(declarationAtRules, rule.Is):
+			minified.Block = minifyBlock(rule.Block)
+		case slices.ContainsFunc(ruleListAtRules, rule.Is):
+			minified.Block = minifyRules(ParseRules(rule.Block).Rules)
+		default:
+			minified.Block = rule.Block
+		}
+	}
+	return minified.Tokens()
+}
+
+// minifyBlock minifies the declarations and the nested rules of a block,
+// separating them with a semicolon.
+func minifyBlock(tokens []Token) []Token {
+	minified := make([]Token, 0)
+	for i := 0; i < len(tokens); {
+		switch tokens[i].Type {
+		case Whitespace, Comment, Semicolon:
+			i++
+			continue
+		}
+		if last := len(minified) - 1; last >= 0 && minified[last].Type != RightBrace && minified[last].Type != Semicolon {
+			minified = append(minified, semicolon)
+		}
+		end, nested := declarationEnd(tokens, i)
+		switch {
+		case nested, tokens[i].Type == AtKeyword:
+			minified = append(minified, minifyRules(ParseRules(tokens[i:min(end+1, len(tokens))]).Rules)...)
+		case tokens[i].Type == Ident:
+			if d, ok := parseDeclaration(tokens[i:end]); ok {
+				minified = append(minified, minifyDeclaration(tokens[i], d)...)
+				break
+			}
+			fallthrough
+		default:
+			minified = append(minified, compact(tokens[i:end], valueDroppable)...)
+		}
+		i = end + 1
+	}
+	return minified
+}
+
+func minifyDeclaration(name Token, d *Declaration) []Token {
+	tokens := []Token{name, colon}
+	if strings.HasPrefix(d.Name, "--") {
+		tokens = append(tokens, d.Value...)
+	} else {
+		zeroLengths := !slices.ContainsFunc(unitlessZeroExceptions, d.Is)
+		tokens = append(tokens, compact(shortenValue(d.Value, zeroLengths), valueDroppable)...)
+	}
+	if d.Important {
+		tokens = append(tokens, Token{Type: Delim, Value: "!", Raw: "!"}, Token{Type: Ident, Value: "important", Raw: "important"})
+	}
+	return tokens
+}
+
+// shortenValue shortens the hex colors of a value and, outside of
+// functions, where a unitless zero may not be allowed, drops the unit of
+// zero lengths.
+func shortenValue(value []Token, zeroLengths bool) []Token {
+	shortened := make([]Token, len(value))
+	depth := 0
+	for i, token := range value {
+		switch {
+		case token.Type == Function || token.Type == LeftParen:
+			depth++
+		case token.Type == RightParen:
+			depth--
+		case token.Type == Hash:
+			token = shortenColor(token)
+		case zeroLengths && depth == 0 && token.Type == Dimension && token.Number == 0 &&
+			slices.Contains(lengthUnits, strings.ToLower(token.Unit)):
+			token = Token{Type: Number, Value: "0", Integer: true, Raw: "0"}
+		}
+		shortened[i] = token
+	}
+	return shortened
+}
+
+func shortenColor(token Token) Token {
+	hex := strings.ToLower(token.Value)
+	if !slices.Contains([]int{3, 4, 6, 8}, len(hex)) || strings.Trim(hex, "0123456789abcdef") != "" {
+		return token
+	}
+	if len(hex) == 6 || len(hex) == 8 {
+		short := make([]byte, 0, len(hex)/2)
+		for i := 0; i < len(hex); i += 2 {
+			if hex[i] != hex[i+1] {
+				short = nil
+				break
+			}
+			short = append(short, hex[i])
+		}
+		if short != nil {
+			hex = string(short)
+		}
+	}
+	return Token{Type: Hash, Value: hex, Raw: "#" + hex}
+}
+
+// compact drops the comments and the whitespace for which droppable
+// returns true, and collapses the remaining whitespace to a single space.
+func compact(tokens []Token, droppable func(prev, next Token, depth int) bool) []Token {
+	compacted := make([]Token, 0, len(tokens))
+	pending := false
+	depth := 0
+	for _, token := range tokens {
+		switch token.Type {
+		case Comment:
+			continue
+		case Whitespace:
+			pending = true
+			continue
+		case RightParen, RightBracket:
+			depth--
+		}
+		if pending && len(compacted) > 0 && !droppable(compacted[len(compacted)-1], token, depth) {
+			compacted = append(compacted, whitespace)
+		}
+		pending = false
+		compacted = append(compacted, token)
+		switch token.Type {
+		case Function, LeftParen, LeftBracket:
+			depth++
+		}
+	}
+	return compacted
+}
+
+func selectorDroppable(prev, next Token, depth int) bool {
+	if prev.Type == Comma || next.Type == Comma || prev.Type == LeftParen || prev.Type == Function ||
+		prev.Type == LeftBracket || next.Type == RightParen || next.Type == RightBracket ||
+		prev.Is(Delim, "=") || next.Is(Delim, "=") {
+		return true
+	}
+	if depth > 0 {
+		return false
+	}
+	isCombinator := func(t Token) bool {
+		return t.Type == Delim && (t.Value == ">" || t.Value == "+" || t.Value == "~")
+	}
+	return isCombinator(prev) || isCombinator(next)
+}
+
+func preludeDroppable(prev, next Token, _ int) bool {
+	return prev.Type == Comma || next.Type == Comma || prev.Type == Colon || next.Type == Colon ||
+		prev.Type == LeftParen || prev.Type == Function || next.Type == RightParen
+}
+
+func valueDroppable(prev, next Token, depth int) bool {
+	if preludeDroppable(prev, next, depth) {
+		return true
+	}
+	return prev.Is(Delim, "/") || next.Is(Delim, "/") || prev.Is(Delim, "!") || next.Is(Delim, "!")
+}
+
+// separate inserts an empty comment between the adjacent tokens which
+// would otherwise tokenize differently, following the serialization rules
+// of CSS Syntax Level 3. Unicode ranges, like U+0025-00FF, tokenize as
+// several tokens but are matched by their text, so they are kept intact.
+func separate(tokens []Token) []Token {
+	separated := make([]Token, 0, len(tokens))
+	urange := false
+	for i, token := range tokens {
+		if i > 0 {
+			prev := tokens[i-1]
+			switch {
+			case prev.Type == Ident && strings.EqualFold(prev.Value, "u") &&
+				(token.Is(Delim, "+") || (isNumeric(token) && strings.HasPrefix(token.Raw, "+"))):
+				urange = true
+			case urange:
+				urange = isNumeric(token) || token.Type == Ident || token.Is(Delim, "?") || token.Is(Delim, "-")
+			}
+			if !urange && needsSeparator(prev, token) {
+				separated = append(separated, Token{Type: Comment, Raw: "/**/"})
+			}
+		}
+		separated = append(separated, token)
+	}
+	return separated
+}
+
+func isNumeric(token Token) bool {
+	return token.Type == Number || token.Type == Percentage || token.Type == Dimension
+}
+
+func needsSeparator(a, b Token) bool {
+	identLike := b.Type == Ident || b.Type == Function || b.Type == URL || b.Type == BadURL
+	numeric := b.Type == Number || b.Type == Percentage || b.Type == Dimension
+	minus := b.Is(Delim, "-")
+	switch {
+	case a.Type == Ident:
+		return identLike || minus || numeric || b.Type == CDC || b.Type == LeftParen
+	case a.Type == AtKeyword, a.Type == Hash, a.Type == Dimension:
+		return identLike || minus || numeric || b.Type == CDC
+	case a.Is(Delim, "#"), a.Is(Delim, "-"):
+		return identLike || minus || numeric
+	case a.Type == Number:
+		return identLike || numeric || b.Is(Delim, "%")
+	case a.Is(Delim, "@"):
+		return identLike || minus
+	case a.Is(Delim, "."), a.Is(Delim, "+"):
+		return numeric
+	case a.Is(Delim, "/"):
+		return b.Is(Delim, "*")
+	default:
+		return false
+	}
+}
@@ -0,0 +1,157 @@
+package css_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/css"
+)
+
+const minifyInput = `@charset "utf-8";
+/* header */
+@import url("a.css") screen and (min-width : 100px);
+@font-face {
+  font-family: "Body";
+  src: url(body.woff2) format("woff2");
+}
+@font-face {
+  font-family: "Body";
+  src: url(body.woff2) format("woff2"); /* duplicate */
+}
+html , body > main   p :hover ,a[ href ^= "http" ]::after {
+  color : #FFFFFF ;
+  background: #aabbcc url( 'bg.png' ) no-repeat !important ;
+  margin: 0px 0.0em 10px -0px;
+  padding: calc( 0px + 1em ) 0% ;
+  flex: 1 1 0px;
+  transition: opacity 0s;
+  --Token : #AABBCC  0px /* kept */ ;
+  & > li { color: #123456 }
+  font: 12px / 1.5 serif;
+}
+@media screen and (max-width: 0px) , print {
+  li:nth-child( 2n + 1 ) { border: 0px solid #11223344 }
+}
+@keyframes spin { from { transform: rotate( 0deg ) } 50.5% { opacity: .5 } }
+`
+
+func TestMinify(t *testing.T) {
+	bee := bee.New(t)
+	minified := css.Minify(minifyInput)
+	bee.Equal(minified, strings.Join([]string{
+		`@charset "utf-8";`,
+		`@import url("a.css") screen and (min-width:100px);`,
+		`@font-face{font-family:"Body";src:url(body.woff2) format("woff2")}`,
+		`html,body>main p :hover,a[href ^="http"]::after{`,
+		`color:#fff;`,
+		`background:#abc url('bg.png') no-repeat!important;`,
+		`margin:0 0 10px 0;`,
+		`padding:calc(0px + 1em) 0%;`,
+		`flex:1 1 0px;`,
+		`transition:opacity 0s;`,
+		`--Token:#AABBCC  0px;`,
+		`&>li{color:#123456}`,
+		`font:12px/1.5 serif}`,
+		`@media screen and (max-width:0px),print{li:nth-child(2n + 1){border:0 solid #1234}}`,
+		`@keyframes spin{from{transform:rotate(0deg)}50.5%{opacity:.5}}`,
+	}, ""))
+	bee.Equal(css.Minify(minified), minified)
+}
+
+func TestMinifyUnknownAtRules(t *testing.T) {
+	bee := bee.New(t)
+	for input, expected := range map[string]string{
+		`@view-transition { navigation: auto }`:                             `@view-transition{ navigation: auto }`,
+		`@position-try --a { top: 0px }`:                                    `@position-try --a{ top: 0px }`,
+		`@font-feature-values Font { @styleset { nice-style: 12 } }`:        `@font-feature-values Font{ @styleset { nice-style: 12 } }`,
+		`@media print { @view-transition { navigation: auto } a { b: c } }`: `@media print{@view-transition{ navigation: auto }a{b:c}}`,
+	} {
+		bee.Equal(css.Minify(input), expected)
+	}
+}
+
+func TestMinifyUnicodeRange(t *testing.T) {
+	bee := bee.New(t)
+	minified := css.Minify(`@font-face { font-family: A; unicode-range: U+0025-00FF, u+4?? }`)
+	bee.Equal(minified, `@font-face{font-family:A;unicode-range:U+0025-00FF,u+4??}`)
+}
+
+func TestMinifyEquivalent(t *testing.T) {
+	bee := bee.New(t)
+	inputs := []string{
+		minifyInput,
+		`a/**/b{color:red}`,
+		`.a{margin:1px/**/-2px;width:calc(100% - 1px)}`,
+		`@media(min-width:1px)and (max-width:2px){a{b:c}}`,
+		`div{color:red;&:hover{color:blue}@media print{color:black}}`,
+		`@font-face{font-family:A;src:url(a.woff)}@font-face{font-family:A;src:url(b.woff)}@font-face{font-family:A;src:url(a.woff)}`,
+		`@font-face { font-family: A; unicode-range: U+0025-00FF, u+4??, U+1e3-2ff, u+a?? }`,
+	}
+	for _, input := range inputs {
+		expected := significantRules(css.Parse(input).Rules)
+		actual := significantRules(css.Parse(css.Minify(input)).Rules)
+		bee.Equal(strings.Join(actual, "\n"), strings.Join(dedupe(expected), "\n"))
+	}
+}
+
+// significantRules returns the rules without comments and whitespace, with
+// colors and zero lengths normalized the way the minifier shortens them.
+func significantRules(rules []*css.Rule) []string {
+	result := make([]string, 0)
+	for _, rule := range rules {
+		sb := strings.Builder{}
+		_, _ = sb.WriteString("@" + rule.AtKeyword + " ")
+		for _, token := range rule.Prelude {
+			if token.Type != css.Whitespace && token.Type != css.Comment {
+				_, _ = sb.WriteString(token.Type.String() + ":" + token.Value + " ")
+			}
+		}
+		_, _ = sb.WriteString("{")
+		nested := css.ParseRules(rule.Block)
+		for _, d := range css.ParseDeclarations(rule.Block) {
+			_, _ = sb.WriteString(d.Name + ":")
+			for _, token := range d.Value {
+				// A comment splits a unicode range, so it is significant.
+				if d.Is("unicode-range") && token.Type == css.Comment {
+					_, _ = sb.WriteString("comment ")
+					continue
+				}
+				if !strings.HasPrefix(d.Name, "--") && (token.Type == css.Whitespace || token.Type == css.Comment) {
+					continue
+				}
+				_, _ = sb.WriteString(normalizeToken(token, d.Name) + " ")
+			}
+			_, _ = sb.WriteString(";")
+		}
+		if len(rule.AtKeyword) > 0 && !rule.Is("font-face") {
+			_, _ = sb.WriteString(strings.Join(significantRules(nested.Rules), "\n"))
+		}
+		_, _ = sb.WriteString("}")
+		result = append(result, sb.String())
+	}
+	return result
+}
+
+func normalizeToken(token css.Token, property string) string {
+	switch {
+	case strings.HasPrefix(property, "--"):
+		return token.Raw
+	case token.Type == css.Hash:
+		return css.Minify("a{color:#" + token.Value + "}")
+	case token.Type == css.Dimension && token.Number == 0 && token.Unit != "deg" && property != "flex":
+		return "number:0"
+	}
+	return token.Type.String() + ":" + token.Value + token.Unit
+}
+
+func dedupe(rules []string) []string {
+	deduped := make([]string, 0, len(rules))
+	for i, rule := range rules {
+		if strings.HasPrefix(rule, "@font-face") && i > 0 && rules[i-1] == rule {
+			continue
+		}
+		deduped = append(deduped, rule)
+	}
+	return deduped
+}
@@ -0,0 +1,191 @@
+package css
+
+import "strings"
+
+// Rule is a qualified rule or an at-rule. The tokens of the rule are kept
+// as they appear in the source, so serializing an unmodified rule
+// reproduces the source exactly.
+type Rule struct {
+	// Leading holds the whitespace, comments, CDO and CDC tokens before
+	// the rule.
+	Leading []Token
+	// AtKeyword is the name of an at-rule without the @ sign, or empty for
+	// qualified rules.
+	AtKeyword string
+	// Prelude holds the tokens after the at-keyword of an at-rule, or the
+	// selector of a qualified rule, up to the block or the semicolon.
+	Prelude []Token
+	// Block holds the tokens between the braces of the block.
+	Block []Token
+	// HasBlock reports whether the rule ends with a block rather than a
+	// semicolon.
+	HasBlock bool
+
+	atToken Token
+}
+
+// Stylesheet is a list of rules.
+type Stylesheet struct {
+	Rules []*Rule
+	// Trailing holds the tokens after the last rule.
+	Trailing []Token
+}
+
+// Parse parses a stylesheet into a list of rules.
+func Parse(s string) *Stylesheet {
+	return ParseRules(Tokenize(s))
+}
+
+// ParseRules parses a list of rules from tokens, for example from the
+// block of a conditional group rule.
+func ParseRules(tokens []Token) *Stylesheet {
+	sheet := &Stylesheet{Rules: make([]*Rule, 0)}
+	leading := make([]Token, 0)
+	for i := 0; i < len(tokens); {
+		switch token := tokens[i]; token.Type {
+		case Whitespace, Comment, CDO, CDC, Semicolon:
+			leading = append(leading, token)
+			i++
+		case AtKeyword:
+			rule := &Rule{Leading: leading, AtKeyword: token.Value, atToken: token}
+			i = rule.consume(tokens, i+1, true)
+			sheet.Rules = append(sheet.Rules, rule)
+			leading = make([]Token, 0)
+		default:
+			rule := &Rule{Leading: leading}
+			next := rule.consume(tokens, i, false)
+			if !rule.HasBlock {
+				leading = append(leading, tokens[i:next]...)
+			} else {
+				sheet.Rules = append(sheet.Rules, rule)
+				leading = make([]Token, 0)
+			}
+			i = next
+		}
+	}
+	sheet.Trailing = leading
+	return sheet
+}
+
+func (r *Rule) consume(tokens []Token, i int, atRule bool) int {
+	start := i
+	for i < len(tokens) {
+		switch tokens[i].Type {
+		case Semicolon:
+			if atRule {
+				r.Prelude = tokens[start:i]
+				return i + 1
+			}
+		case LeftBrace:
+			r.Prelude = tokens[start:i]
+			end := matchingEnd(tokens, i)
+			r.HasBlock = true
+			if end < len(tokens) {
+				r.Block = tokens[i+1 : end]
+				return end + 1
+			}
+			r.Block = tokens[i+1:]
+			return len(tokens)
+		case LeftParen, LeftBracket, Function:
+			i = matchingEnd(tokens, i)
+			continue
+		}
+		i++
+	}
+	r.Prelude = tokens[start:]
+	return len(tokens)
+}
+
+// matchingEnd returns the index of the token closing the block, function
+// or parenthesis opened at tokens[i], or len(tokens) if it is unclosed.
+func matchingEnd(tokens []Token, i int) int {
+	closing := map[TokenType]TokenType{
+		LeftBrace:   RightBrace,
+		LeftBracket: RightBracket,
+		LeftParen:   RightParen,
+		Function:    RightParen,
+	}
+	stack := []TokenType{closing[tokens[i].Type]}
+	for i++; i < len(tokens); i++ {
+		typ := tokens[i].Type
+		switch {
+		case typ == stack[len(stack)-1]:
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return i
+			}
+		case typ == LeftBrace || typ == LeftBracket || typ == LeftParen || typ == Function:
+			stack = append(stack, closing[typ])
+		}
+	}
+	return len(tokens)
+}
+
+// Is reports whether the rule is an at-rule with the name, ignoring ASCII
+// case.
+func (r *Rule) Is(name string) bool {
+	return len(r.AtKeyword) > 0 && strings.EqualFold(r.AtKeyword, name)
+}
+
+// Tokens returns the tokens of the rule.
+func (r *Rule) Tokens() []Token {
+	tokens := make([]Token, 0, len(r.Leading)+len(r.Prelude)+len(r.Block)+3)
+	tokens = append(tokens, r.Leading...)
+	if len(r.AtKeyword) > 0 {
+		if !r.atToken.Is(AtKeyword, r.AtKeyword) {
+			r.atToken = Token{Type: AtKeyword, Value: r.AtKeyword, Raw: "@" + r.AtKeyword}
+		}
+		tokens = append(tokens, r.atToken)
+	}
+	tokens = append(tokens, r.Prelude...)
+	if r.HasBlock {
+		tokens = append(tokens, Token{Type: LeftBrace, Value: "{", Raw: "{"})
+		tokens = append(tokens, r.Block...)
+		tokens = append(tokens, Token{Type: RightBrace, Value: "}", Raw: "}"})
+	} else if len(r.AtKeyword) > 0 {
+		tokens = append(tokens, Token{Type: Semicolon, Value: ";", Raw: ";"})
+	}
+	return tokens
+}
+
+// Tokens returns the tokens of the stylesheet.
+func (s *Stylesheet) Tokens() []Token {
+	tokens := make([]Token, 0)
+	for _, rule := range s.Rules {
+		tokens = append(tokens, rule.Tokens()...)
+	}
+	return append(tokens, s.Trailing...)
+}
+
+func (s *Stylesheet) String() string {
+	return Serialize(s.Tokens())
+}
+
+// Trim returns tokens without leading and trailing whitespace and comments.
+func Trim(tokens []Token) []Token {
+	start, end := 0, len(tokens)
+	for start < end && (tokens[start].Type == Whitespace || tokens[start].Type == Comment) {
+		start++
+	}
+	for end > start && (tokens[end-1].Type == Whitespace || tokens[end-1].Type == Comment) {
+		end--
+	}
+	return tokens[start:end]
+}
+
+// SplitCommas splits tokens at the commas outside of blocks and functions
+// and trims the parts, for example the entries of a comma separated value.
+func SplitCommas(tokens []Token) [][]Token {
+	parts := make([][]Token, 0)
+	start := 0
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i].Type {
+		case LeftBrace, LeftBracket, LeftParen, Function:
+			i = matchingEnd(tokens, i)
+		case Comma:
+			parts = append(parts, Trim(tokens[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, Trim(tokens[start:]))
+}
@@ -0,0 +1,44 @@
+package css_test
+
+import (
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/css"
+)
+
+func TestParse(t *testing.T) {
+	bee := bee.New(t)
+	input := `@charset "utf-8";
+/* comment */
+@import url(a.css) screen;
+a, b[href="{"] { color: red; background: url(x.png) }
+@media (min-width: 10px) { .c { margin: 0 } }
+@font-face { font-family: F; src: url(f.woff2) }
+`
+	sheet := css.Parse(input)
+	bee.Equal(sheet.String(), input)
+	bee.Equal(len(sheet.Rules), 5)
+	bee.Equal(sheet.Rules[0].AtKeyword, "charset")
+	bee.False(sheet.Rules[0].HasBlock)
+	bee.Equal(sheet.Rules[1].AtKeyword, "import")
+	bee.Equal(css.Serialize(css.Trim(sheet.Rules[1].Prelude)), "url(a.css) screen")
+	bee.Equal(sheet.Rules[2].AtKeyword, "")
+	bee.Equal(css.Serialize(css.Trim(sheet.Rules[2].Prelude)), `a, b[href="{"]`)
+	bee.Equal(css.Serialize(css.Trim(sheet.Rules[2].Block)), "color: red; background: url(x.png)")
+	bee.Equal(sheet.Rules[3].AtKeyword, "media")
+	nested := css.ParseRules(sheet.Rules[3].Block)
+	bee.Equal(len(nested.Rules), 1)
+	bee.Equal(css.Serialize(css.Trim(nested.Rules[0].Prelude)), ".c")
+	bee.Equal(sheet.Rules[4].AtKeyword, "font-face")
+}
+
+func TestParseModified(t *testing.T) {
+	bee := bee.New(t)
+	sheet := css.Parse(`@import "a.css"; a { color: red }`)
+	sheet.Rules[0].AtKeyword = "media"
+	sheet.Rules[0].Prelude = css.Tokenize(" print ")
+	sheet.Rules[0].HasBlock = true
+	sheet.Rules[0].Block = css.Tokenize("b{}")
+	bee.Equal(sheet.String(), `@media print {b{}} a { color: red }`)
+}
@@ -0,0 +1,651 @@
+package css
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+// SelectorList is a comma separated list of complex selectors.
+type SelectorList []*Selector
+
+// Selector is a complex selector, a sequence of compound selectors joined
+// by combinators.
+type Selector struct {
+	compounds []*compound
+	// combinators[i] joins compounds[i] and compounds[i+1], it is one of
+	// ' ', '>', '+' and '~'.
+	combinators []byte
+}
+
+type compound struct {
+	tag           string
+	ids           []string
+	classes       []string
+	attrs         []*attrSelector
+	pseudos       []*pseudoClass
+	pseudoElement string
+}
+
+type attrSelector struct {
+	name  string
+	op    string
+	value string
+	fold  bool
+}
+
+type pseudoClass struct {
+	name string
+	a, b int
+	of   SelectorList
+}
+
+// MatchOptions controls how selectors which depend on the state of the
+// page are matched.
+type MatchOptions struct {
+	// AssumeState makes state dependent pseudo-classes like :hover and
+	// :checked, and attribute selectors, which scripts commonly toggle,
+	// match every element.
+	AssumeState bool
+}
+
+// legacyPseudoElements are the pseudo-elements which may be written with a
+// single colon.
+var legacyPseudoElements = []string{"before", "after", "first-line", "first-letter"}
+
+// structuralPseudoClasses depend only on the position of the element in
+// the document tree.
+var structuralPseudoClasses = []string{
+	"root", "empty",
+	"first-child", "last-child", "only-child", "nth-child", "nth-last-child",
+	"first-of-type", "last-of-type", "only-of-type", "nth-of-type", "nth-last-of-type",
+}
+
+// logicalPseudoClasses take a selector list argument.
+var logicalPseudoClasses = []string{"not", "is", "where", "matches", "-webkit-any", "-moz-any"}
+
+var formElements = []string{"button", "input", "select", "textarea", "optgroup", "option", "fieldset"}
+
+// statePseudoClasses are the state dependent pseudo-classes which are
+// matched against the state of the document as it is archived, where no
+// element is hovered, focused or targeted.
+var statePseudoClasses = map[string]func(node *html.Node) bool{
+	"hover":            never,
+	"active":           never,
+	"focus":            never,
+	"focus-visible":    never,
+	"focus-within":     never,
+	"target":           never,
+	"target-within":    never,
+	"visited":          never,
+	"fullscreen":       never,
+	"modal":            never,
+	"popover-open":     never,
+	"user-valid":       never,
+	"user-invalid":     never,
+	"autofill":         never,
+	"-webkit-autofill": never,
+	"link":             isLink,
+	"any-link":         isLink,
+	"checked": func(node *html.Node) bool {
+		_, checked := node.GetAttr("checked")
+		_, selected := node.GetAttr("selected")
+		return (node.Tag() == "input" && checked) || (node.Tag() == "option" && selected)
+	},
+	"disabled": func(node *html.Node) bool {
+		_, disabled := node.GetAttr("disabled")
+		return disabled && slices.Contains(formElements, node.Tag())
+	},
+	"enabled": func(node *html.Node) bool {
+		_, disabled := node.GetAttr("disabled")
+		return !disabled && slices.Contains(formElements, node.Tag())
+	},
+	"required": func(node *html.Node) bool {
+		_, required := node.GetAttr("required")
+		return required && slices.Contains([]string{"input", "select", "textarea"}, node.Tag())
+	},
+	"optional": func(node *html.Node) bool {
+		_, required := node.GetAttr("required")
+		return !required && slices.Contains([]string{"input", "select", "textarea"}, node.Tag())
+	},
+	"open": func(node *html.Node) bool {
+		_, open := node.GetAttr("open")
+		return open && (node.Tag() == "details" || node.Tag() == "dialog")
+	},
+}
+
+func never(*html.Node) bool {
+	return false
+}
+
+func isLink(node *html.Node) bool {
+	_, ok := node.GetAttr("href")
+	return ok && (node.Tag() == "a" || node.Tag() == "area")
+}
+
+// ParseSelectors parses a selector list, for example the prelude of a
+// style rule. Namespaced selectors and the column combinator are not
+// supported and result in an error.
+func ParseSelectors(tokens []Token) (SelectorList, error) {
+	list := make(SelectorList, 0)
+	start := 0
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) {
+			switch tokens[i].Type {
+			case Function, LeftParen, LeftBracket:
+				i = matchingEnd(tokens, i)
+				continue
+			case Comma:
+			default:
+				continue
+			}
+		}
+		selector, err := parseSelector(Trim(tokens[start:min(i, len(tokens))]))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, selector)
+		start = i + 1
+	}
+	return list, nil
+}
+
+func parseSelector(tokens []Token) (*Selector, error) {
+	s := &Selector{}
+	for i := 0; ; {
+		c, next, err := parseCompound(tokens, i)
+		if err != nil {
+			return nil, err
+		}
+		s.compounds = append(s.compounds, c)
+		i = next
+		whitespace := false
+		for i < len(tokens) && (tokens[i].Type == Whitespace || tokens[i].Type == Comment) {
+			whitespace = true
+			i++
+		}
+		if i == len(tokens) {
+			return s, nil
+		}
+		combinator := byte(' ')
+		if token := tokens[i]; token.Type == Delim && strings.Contains(">+~", token.Value) {
+			combinator = token.Value[0]
+			i = skipWhitespace(tokens, i+1)
+		} else if !whitespace {
+			return nil, fmt.Errorf("unexpected %s in selector", token.Type)
+		}
+		s.combinators = append(s.combinators, combinator)
+	}
+}
+
+func parseCompound(tokens []Token, i int) (*compound, int, error) {
+	c := &compound{}
+	start := i
+	if i < len(tokens) && (tokens[i].Type == Ident || tokens[i].Is(Delim, "*")) {
+		if tokens[i].Type == Ident {
+			c.tag = strings.ToLower(tokens[i].Value)
+		}
+		i++
+	}
+	for i < len(tokens) {
+		switch token := tokens[i]; {
+		case token.Type == Hash:
+			if !token.ID {
+				return nil, 0, fmt.Errorf("invalid id selector #%s", token.Value)
+			}
+			c.ids = append(c.ids, token.Value)
+			i++
+		case token.Is(Delim, "."):
+			if i+1 >= len(tokens) || tokens[i+1].Type != Ident {
+				return nil, 0, errors.New("invalid class selector")
+			}
+			c.classes = append(c.classes, tokens[i+1].Value)
+			i += 2
+		case token.Type == LeftBracket:
+			end := matchingEnd(tokens, i)
+			attr, err := parseAttrSelector(Trim(tokens[i+1 : min(end, len(tokens))]))
+			if err != nil {
+				return nil, 0, err
+			}
+			c.attrs = append(c.attrs, attr)
+			i = end + 1
+		case token.Type == Colon:
+			next, err := c.parsePseudo(tokens, i)
+			if err != nil {
+				return nil, 0, err
+			}
+			i = next
+		case token.Is(Delim, "|"):
+			return nil, 0, errors.New("namespaced selectors are not supported")
+		default:
+			if i == start {
+				return nil, 0, fmt.Errorf("unexpected %s in selector", token.Type)
+			}
+			return c, i, nil
+		}
+	}
+	if i == start {
+		return nil, 0, errors.New("empty selector")
+	}
+	return c, i, nil
+}
+
+// parsePseudo parses the pseudo-class or pseudo-element at tokens[i] and
+// returns the index after it. Pseudo-elements do not affect matching, they
+// match whenever their originating element does.
+func (c *compound) parsePseudo(tokens []Token, i int) (int, error) {
+	element := i+1 < len(tokens) && tokens[i+1].Type == Colon
+	if element {
+		i++
+	}
+	i++
+	if i >= len(tokens) {
+		return 0, errors.New("missing pseudo-class name")
+	}
+	token := tokens[i]
+	name := strings.ToLower(token.Value)
+	switch token.Type {
+	case Ident:
+		if element || slices.Contains(legacyPseudoElements, name) {
+			c.pseudoElement = name
+		} else {
+			c.pseudos = append(c.pseudos, &pseudoClass{name: name})
+		}
+		return i + 1, nil
+	case Function:
+		end := matchingEnd(tokens, i)
+		if element {
+			c.pseudoElement = name
+		} else {
+			p, err := parsePseudoFunction(name, Trim(tokens[i+1:min(end, len(tokens))]))
+			if err != nil {
+				return 0, err
+			}
+			c.pseudos = append(c.pseudos, p)
+		}
+		return end + 1, nil
+	default:
+		return 0, fmt.Errorf("unexpected %s after colon", token.Type)
+	}
+}
+
+func parsePseudoFunction(name string, args []Token) (*pseudoClass, error) {
+	p := &pseudoClass{name: name}
+	var err error
+	switch {
+	case slices.Contains(logicalPseudoClasses, name):
+		p.of, err = ParseSelectors(args)
+	case name == "nth-child" || name == "nth-last-child":
+		of := slices.IndexFunc(args, func(t Token) bool { return t.Is(Ident, "of") })
+		if of >= 0 {
+			p.of, err = ParseSelectors(Trim(args[of+1:]))
+			if err != nil {
+				return nil, err
+			}
+			args = args[:of]
+		}
+		p.a, p.b, err = parseNth(args)
+	case name == "nth-of-type" || name == "nth-last-of-type":
+		p.a, p.b, err = parseNth(args)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseNth parses the An+B notation of the :nth-* pseudo-classes.
+func parseNth(tokens []Token) (int, int, error) {
+	s := strings.ToLower(strings.Join(strings.Fields(Serialize(tokens)), ""))
+	switch s {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+	aStr, bStr, ok := strings.Cut(s, "n")
+	if !ok {
+		b, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid An+B %s", s)
+		}
+		return 0, b, nil
+	}
+	a, b := 1, 0
+	switch aStr {
+	case "", "+":
+	case "-":
+		a = -1
+	default:
+		var err error
+		if a, err = strconv.Atoi(aStr); err != nil {
+			return 0, 0, fmt.Errorf("invalid An+B %s", s)
+		}
+	}
+	if len(bStr) > 0 {
+		var err error
+		if b, err = strconv.Atoi(bStr); err != nil {
+			return 0, 0, fmt.Errorf("invalid An+B %s", s)
+		}
+	}
+	return a, b, nil
+}
+
+func parseAttrSelector(tokens []Token) (*attrSelector, error) {
+	if len(tokens) == 0 || tokens[0].Type != Ident {
+		return nil, errors.New("invalid attribute selector")
+	}
+	attr := &attrSelector{name: strings.ToLower(tokens[0].Value)}
+	rest := Trim(tokens[1:])
+	if len(rest) == 0 {
+		return attr, nil
+	}
+	switch {
+	case rest[0].Is(Delim, "="):
+		attr.op = "="
+		rest = Trim(rest[1:])
+	case len(rest) > 1 && rest[0].Type == Delim && strings.Contains("~|^$*", rest[0].Value) && rest[1].Is(Delim, "="):
+		attr.op = rest[0].Value + "="
+		rest = Trim(rest[2:])
+	default:
+		return nil, errors.New("invalid attribute selector")
+	}
+	if len(rest) == 0 || (rest[0].Type != Ident && rest[0].Type != String) {
+		return nil, errors.New("invalid attribute selector value")
+	}
+	attr.value = rest[0].Value
+	rest = Trim(rest[1:])
+	if len(rest) > 0 {
+		if rest[0].Type != Ident || !(rest[0].Is(Ident, "i") || rest[0].Is(Ident, "s")) || len(rest) > 1 {
+			return nil, errors.New("invalid attribute selector modifier")
+		}
+		attr.fold = rest[0].Is(Ident, "i")
+	}
+	return attr, nil
+}
+
+// PseudoElement returns the name of the pseudo-element the selector
+// targets, or an empty string if it targets the matched element itself.
+func (s *Selector) PseudoElement() string {
+	return s.compounds[len(s.compounds)-1].pseudoElement
+}
+
+// Specificity returns the number of id selectors, of class, attribute and
+// pseudo-class selectors, and of type and pseudo-element selectors.
+func (s *Selector) Specificity() [3]int {
+	specificity := [3]int{}
+	for _, c := range s.compounds {
+		specificity[0] += len(c.ids)
+		specificity[1] += len(c.classes) + len(c.attrs)
+		if len(c.tag) > 0 {
+			specificity[2]++
+		}
+		if len(c.pseudoElement) > 0 {
+			specificity[2]++
+		}
+		for _, p := range c.pseudos {
+			switch p.name {
+			case "where":
+			case "not", "is", "matches", "-webkit-any", "-moz-any":
+				specificity = addSpecificity(specificity, p.of.maxSpecificity())
+			case "nth-child", "nth-last-child":
+				specificity[1]++
+				specificity = addSpecificity(specificity, p.of.maxSpecificity())
+			default:
+				specificity[1]++
+			}
+		}
+	}
+	return specificity
+}
+
+func (l SelectorList) maxSpecificity() [3]int {
+	specificity := [3]int{}
+	for _, s := range l {
+		if other := s.Specificity(); slices.Compare(other[:], specificity[:]) > 0 {
+			specificity = other
+		}
+	}
+	return specificity
+}
+
+func addSpecificity(a, b [3]int) [3]int {
+	return [3]int{a[0] + b[0], a[1] + b[1], a[2] + b[2]}
+}
+
+// Matches reports whether any selector of the list matches the element.
+// Pseudo-classes which cannot be evaluated on a static document, like
+// :has() or :lang(), are assumed to match.
+func (l SelectorList) Matches(node *html.Node, opts MatchOptions) bool {
+	return slices.ContainsFunc(l, func(s *Selector) bool {
+		return s.Matches(node, opts)
+	})
+}
+
+// Matches reports whether the selector matches the element.
+func (s *Selector) Matches(node *html.Node, opts MatchOptions) bool {
+	return s.match(len(s.compounds)-1, node, opts)
+}
+
+func (s *Selector) match(i int, node *html.Node, opts MatchOptions) bool {
+	if !s.compounds[i].matches(node, opts) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch s.combinators[i-1] {
+	case '>':
+		parent := parentElement(node)
+		return parent != nil && s.match(i-1, parent, opts)
+	case '+':
+		prev := prevElement(node)
+		return prev != nil && s.match(i-1, prev, opts)
+	case '~':
+		for prev := prevElement(node); prev != nil; prev = prevElement(prev) {
+			if s.match(i-1, prev, opts) {
+				return true
+			}
+		}
+	default:
+		for parent := parentElement(node); parent != nil; parent = parentElement(parent) {
+			if s.match(i-1, parent, opts) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exact reports whether matching the selector list involves no assumption,
+// so its negation can be evaluated.
+func (l SelectorList) exact(opts MatchOptions) bool {
+	for _, s := range l {
+		for _, c := range s.compounds {
+			if len(c.attrs) > 0 && opts.AssumeState {
+				return false
+			}
+			for _, p := range c.pseudos {
+				if !p.exact(opts) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func (c *compound) matches(node *html.Node, opts MatchOptions) bool {
+	if !node.IsElement() {
+		return false
+	}
+	if len(c.tag) > 0 && !strings.EqualFold(node.Tag(), c.tag) {
+		return false
+	}
+	for _, id := range c.ids {
+		if v, _ := node.GetAttr("id"); v != id {
+			return false
+		}
+	}
+	if len(c.classes) > 0 {
+		v, _ := node.GetAttr("class")
+		classes := strings.Fields(v)
+		for _, class := range c.classes {
+			if !slices.Contains(classes, class) {
+				return false
+			}
+		}
+	}
+	if !opts.AssumeState {
+		for _, attr := range c.attrs {
+			if !attr.matches(node) {
+				return false
+			}
+		}
+	}
+	for _, p := range c.pseudos {
+		if !p.matches(node, opts) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *attrSelector) matches(node *html.Node) bool {
+	v, ok := node.GetAttr(a.name)
+	if !ok {
+		return false
+	}
+	value := a.value
+	if a.fold {
+		v, value = strings.ToLower(v), strings.ToLower(value)
+	}
+	switch a.op {
+	case "=":
+		return v == value
+	case "~=":
+		return slices.Contains(strings.Fields(v), value)
+	case "|=":
+		return v == value || strings.HasPrefix(v, value+"-")
+	case "^=":
+		return len(value) > 0 && strings.HasPrefix(v, value)
+	case "$=":
+		return len(value) > 0 && strings.HasSuffix(v, value)
+	case "*=":
+		return len(value) > 0 && strings.Contains(v, value)
+	default:
+		return true
+	}
+}
+
+func (p *pseudoClass) exact(opts MatchOptions) bool {
+	switch {
+	case slices.Contains(structuralPseudoClasses, p.name), slices.Contains(logicalPseudoClasses, p.name):
+		return p.of.exact(opts)
+	case statePseudoClasses[p.name] != nil:
+		return !opts.AssumeState
+	default:
+		return false
+	}
+}
+
+func (p *pseudoClass) matches(node *html.Node, opts MatchOptions) bool {
+	switch p.name {
+	case "root":
+		return parentElement(node) == nil
+	case "empty":
+		return !slices.ContainsFunc(node.Children(), func(child *html.Node) bool {
+			return child.IsElement() || child.IsText()
+		})
+	case "first-child":
+		return prevElement(node) == nil
+	case "last-child":
+		return nextElement(node) == nil
+	case "only-child":
+		return prevElement(node) == nil && nextElement(node) == nil
+	case "first-of-type":
+		return countSiblings(node, prevElement, sameTag(node)) == 0
+	case "last-of-type":
+		return countSiblings(node, nextElement, sameTag(node)) == 0
+	case "only-of-type":
+		return countSiblings(node, prevElement, sameTag(node))+countSiblings(node, nextElement, sameTag(node)) == 0
+	case "nth-child", "nth-last-child":
+		sibling := prevElement
+		if p.name == "nth-last-child" {
+			sibling = nextElement
+		}
+		filter := func(*html.Node) bool { return true }
+		if p.of != nil {
+			if !p.of.Matches(node, opts) {
+				return false
+			}
+			filter = func(n *html.Node) bool { return p.of.Matches(n, opts) }
+		}
+		return nth(p.a, p.b, countSiblings(node, sibling, filter)+1)
+	case "nth-of-type":
+		return nth(p.a, p.b, countSiblings(node, prevElement, sameTag(node))+1)
+	case "nth-last-of-type":
+		return nth(p.a, p.b, countSiblings(node, nextElement, sameTag(node))+1)
+	case "not":
+		return !p.of.exact(opts) || !p.of.Matches(node, opts)
+	case "is", "where", "matches", "-webkit-any", "-moz-any":
+		return p.of.Matches(node, opts)
+	}
+	if state, ok := statePseudoClasses[p.name]; ok && !opts.AssumeState {
+		return state(node)
+	}
+	return true
+}
+
+func nth(a, b, pos int) bool {
+	if a == 0 {
+		return pos == b
+	}
+	n := pos - b
+	return n%a == 0 && n/a >= 0
+}
+
+func sameTag(node *html.Node) func(*html.Node) bool {
+	return func(n *html.Node) bool {
+		return n.Tag() == node.Tag()
+	}
+}
+
+func countSiblings(node *html.Node, sibling func(*html.Node) *html.Node, filter func(*html.Node) bool) int {
+	count := 0
+	for n := sibling(node); n != nil; n = sibling(n) {
+		if filter(n) {
+			count++
+		}
+	}
+	return count
+}
+
+func parentElement(node *html.Node) *html.Node {
+	if parent := node.Parent(); parent != nil && parent.IsElement() {
+		return parent
+	}
+	return nil
+}
+
+func prevElement(node *html.Node) *html.Node {
+	for n := node.PrevSibling(); n != nil; n = n.PrevSibling() {
+		if n.IsElement() {
+			return n
+		}
+	}
+	return nil
+}
+
+func nextElement(node *html.Node) *html.Node {
+	for n := node.NextSibling(); n != nil; n = n.NextSibling() {
+		if n.IsElement() {
+			return n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package css_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/css"
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+func TestSelectorMatches(t *testing.T) {
+	bee := bee.New(t)
+	s := `<html><body>
+<nav id="menu" class="nav main"><ul><li><a href="/">home</a></li><li class="active"><a>about</a></li><li></li></ul></nav>
+<main><h1 lang="en-US">title</h1><p>one</p><p>two</p><input type="checkbox" checked></main>
+</body></html>`
+	root, err := html.Parse(strings.NewReader(s))
+	bee.Nil(err)
+	tests := []struct {
+		selector     string
+		strict       bool
+		conservative bool
+	}{
+		{"nav", true, true},
+		{"NAV#menu.nav.main", true, true},
+		{".missing", false, false},
+		{"nav > ul > li > a", true, true},
+		{"main a", false, false},
+		{"h1 + p", true, true},
+		{"h1 ~ input", true, true},
+		{"p + h1", false, false},
+		{"li:first-child a", true, true},
+		{"li:nth-child(2n+1):empty", true, true},
+		{"li:nth-child(2 of .active)", false, false},
+		{"li:nth-last-child(-n+1)", true, true},
+		{"p:nth-of-type(2)", true, true},
+		{"p:only-of-type", false, false},
+		{":root > body", true, true},
+		{"a:not([href])", true, true},
+		{"nav:not(.nav)", false, false},
+		{"a:not(:hover)", true, true},
+		{":is(main, aside) > p::before", true, true},
+		{"[lang|=en]", true, true},
+		{`[type="CHECKBOX" i]`, true, true},
+		{"[type=radio]", false, true},
+		{"a:hover", false, true},
+		{"input:checked", true, true},
+		{"input:disabled", false, true},
+		{"a:link", true, true},
+		{"li:has(> a)", true, true},
+		{"h1:lang(en)", true, true},
+		{"p, .missing", true, true},
+	}
+	elements := make([]*html.Node, 0)
+	for node := range root.FindAll(html.NodeFilterFunc((*html.Node).IsElement)) {
+		elements = append(elements, node)
+	}
+	for _, test := range tests {
+		selectors, err := css.ParseSelectors(css.Tokenize(test.selector))
+		bee.Nil(err)
+		for _, conservative := range []bool{false, true} {
+			matched := false
+			for _, node := range elements {
+				if selectors.Matches(node, css.MatchOptions{AssumeState: conservative}) {
+					matched = true
+					break
+				}
+			}
+			expected := test.strict
+			if conservative {
+				expected = test.conservative
+			}
+			if matched != expected {
+				t.Errorf("%s (conservative: %t): expected %t, got %t", test.selector, conservative, expected, matched)
+			}
+		}
+	}
+}
+
+func TestSelectorSpecificity(t *testing.T) {
+	bee := bee.New(t)
+	tests := []struct {
+		selector      string
+		specificity   [3]int
+		pseudoElement string
+	}{
+		{"*", [3]int{0, 0, 0}, ""},
+		{"li > a.nav:hover", [3]int{0, 2, 2}, ""},
+		{"#menu [href]::before", [3]int{1, 1, 1}, "before"},
+		{"p:after", [3]int{0, 0, 2}, "after"},
+		{":is(#a, .b) :where(#c) :not(p)", [3]int{1, 0, 1}, ""},
+		{"li:nth-child(2 of .a)", [3]int{0, 2, 1}, ""},
+	}
+	for _, test := range tests {
+		selectors, err := css.ParseSelectors(css.Tokenize(test.selector))
+		bee.Nil(err)
+		bee.Equal(selectors[0].Specificity(), test.specificity)
+		bee.Equal(selectors[0].PseudoElement(), test.pseudoElement)
+	}
+}
+
+func TestParseSelectorsInvalid(t *testing.T) {
+	bee := bee.New(t)
+	for _, selector := range []string{"", "a,", "a >", "svg|rect", "#1a", ". a", "[=a]", "a:nth-child(x)"} {
+		_, err := css.ParseSelectors(css.Tokenize(selector))
+		bee.NotNil(err)
+	}
+}
+
+func TestParseDeclarations(t *testing.T) {
+	bee := bee.New(t)
+	declarations := css.ParseDeclarations(css.Tokenize(`color: red; font: 12px "Open Sans" !important;
+&:hover { color: blue } invalid; --Custom: a;b`))
+	bee.Equal(len(declarations), 3)
+	bee.True(declarations[0].Is("COLOR"))
+	bee.Equal(css.Serialize(declarations[0].Value), "red")
+	bee.True(declarations[1].Is("font"))
+	bee.True(declarations[1].Important)
+	bee.Equal(css.Serialize(declarations[1].Value), `12px "Open Sans"`)
+	bee.True(declarations[2].Is("--Custom"))
+	bee.False(declarations[2].Is("--custom"))
+}
@@ -0,0 +1,111 @@
+package css
+
+import (
+	"fmt"
+	"strings"
+)
+
+type TokenType int
+
+const (
+	Ident TokenType = iota
+	Function
+	AtKeyword
+	Hash
+	String
+	BadString
+	URL
+	BadURL
+	Delim
+	Number
+	Percentage
+	Dimension
+	Whitespace
+	CDO
+	CDC
+	Colon
+	Semicolon
+	Comma
+	LeftBracket
+	RightBracket
+	LeftParen
+	RightParen
+	LeftBrace
+	RightBrace
+	Comment
+)
+
+func (t TokenType) String() string {
+	names := [...]string{
+		"ident", "function", "at-keyword", "hash", "string", "bad-string", "url", "bad-url", "delim",
+		"number", "percentage", "dimension", "whitespace", "CDO", "CDC", "colon", "semicolon", "comma",
+		"[", "]", "(", ")", "{", "}", "comment",
+	}
+	if int(t) < 0 || int(t) >= len(names) {
+		return fmt.Sprintf("TokenType(%d)", int(t))
+	}
+	return names[t]
+}
+
+// Token is a CSS token as defined by CSS Syntax Level 3. Comments are kept
+// as tokens so that serializing the tokens reproduces the source exactly.
+type Token struct {
+	Type TokenType
+	// Value is the unescaped name of idents, functions, at-keywords and
+	// hashes, the contents of strings and URLs, the code point of delims and
+	// the representation of numeric tokens.
+	Value string
+	// Unit is the unescaped unit of dimensions.
+	Unit string
+	// Number is the numeric value of numbers, percentages and dimensions.
+	Number float64
+	// Integer reports whether a numeric token has the integer type flag.
+	Integer bool
+	// ID reports whether a hash token has the id type flag.
+	ID bool
+	// Raw is the source text of the token.
+	Raw string
+}
+
+// Is reports whether the token has the type and, ignoring ASCII case, the
+// value.
+func (t Token) Is(typ TokenType, value string) bool {
+	return t.Type == typ && strings.EqualFold(t.Value, value)
+}
+
+// NewURL returns a url() token referencing value.
+func NewURL(value string) Token {
+	return Token{Type: URL, Value: value, Raw: fmt.Sprintf("url(%s)", quote(value, '"'))}
+}
+
+// NewString returns a string token quoted with the quote character.
+func NewString(value string, q rune) Token {
+	return Token{Type: String, Value: value, Raw: quote(value, q)}
+}
+
+// Serialize returns the source text of the tokens.
+func Serialize(tokens []Token) string {
+	sb := strings.Builder{}
+	for _, token := range tokens {
+		_, _ = sb.WriteString(token.Raw)
+	}
+	return sb.String()
+}
+
+func quote(value string, q rune) string {
+	sb := strings.Builder{}
+	_, _ = sb.WriteRune(q)
+	for _, r := range value {
+		switch {
+		case r == q || r == '\\':
+			_, _ = sb.WriteRune('\\')
+			_, _ = sb.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			_, _ = fmt.Fprintf(&sb, "\\%x ", r)
+		default:
+			_, _ = sb.WriteRune(r)
+		}
+	}
+	_, _ = sb.WriteRune(q)
+	return sb.String()
+}
@@ -0,0 +1,384 @@
+package css
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const eof = -1
+
+type tokenizer struct {
+	input []rune
+	pos   int
+}
+
+// Tokenize splits a stylesheet into tokens following the tokenization
+// algorithm of CSS Syntax Level 3. The tokenizer never fails, malformed
+// input results in bad-string, bad-url or delim tokens.
+func Tokenize(s string) []Token {
+	t := &tokenizer{input: []rune(s)}
+	tokens := make([]Token, 0)
+	for t.pos < len(t.input) {
+		tokens = append(tokens, t.next())
+	}
+	return tokens
+}
+
+func (t *tokenizer) peek(n int) rune {
+	if t.pos+n >= len(t.input) {
+		return eof
+	}
+	return t.input[t.pos+n]
+}
+
+func (t *tokenizer) consume() rune {
+	r := t.peek(0)
+	if r != eof {
+		t.pos++
+	}
+	return r
+}
+
+func (t *tokenizer) next() Token {
+	start := t.pos
+	token := t.consumeToken()
+	token.Raw = string(t.input[start:t.pos])
+	return token
+}
+
+func (t *tokenizer) consumeToken() Token {
+	r := t.peek(0)
+	switch {
+	case r == '/' && t.peek(1) == '*':
+		t.pos += 2
+		for t.pos < len(t.input) && !(t.peek(0) == '*' && t.peek(1) == '/') {
+			t.pos++
+		}
+		t.pos = min(t.pos+2, len(t.input))
+		return Token{Type: Comment}
+	case isWhitespace(r):
+		for isWhitespace(t.peek(0)) {
+			t.pos++
+		}
+		return Token{Type: Whitespace, Value: " "}
+	case r == '"' || r == '\'':
+		t.pos++
+		return t.consumeString(r)
+	case r == '#':
+		if isIdent(t.peek(1)) || isValidEscape(t.peek(1), t.peek(2)) {
+			t.pos++
+			id := startsIdent(t.peek(0), t.peek(1), t.peek(2))
+			return Token{Type: Hash, Value: t.consumeIdentSequence(), ID: id}
+		}
+	case r == '(':
+		t.pos++
+		return Token{Type: LeftParen, Value: "("}
+	case r == ')':
+		t.pos++
+		return Token{Type: RightParen, Value: ")"}
+	case r == '[':
+		t.pos++
+		return Token{Type: LeftBracket, Value: "["}
+	case r == ']':
+		t.pos++
+		return Token{Type: RightBracket, Value: "]"}
+	case r == '{':
+		t.pos++
+		return Token{Type: LeftBrace, Value: "{"}
+	case r == '}':
+		t.pos++
+		return Token{Type: RightBrace, Value: "}"}
+	case r == ',':
+		t.pos++
+		return Token{Type: Comma, Value: ","}
+	case r == ':':
+		t.pos++
+		return Token{Type: Colon, Value: ":"}
+	case r == ';':
+		t.pos++
+		return Token{Type: Semicolon, Value: ";"}
+	case r == '+' || r == '.':
+		if startsNumber(r, t.peek(1), t.peek(2)) {
+			return t.consumeNumeric()
+		}
+	case r == '-':
+		if startsNumber(r, t.peek(1), t.peek(2)) {
+			return t.consumeNumeric()
+		}
+		if t.peek(1) == '-' && t.peek(2) == '>' {
+			t.pos += 3
+			return Token{Type: CDC, Value: "-->"}
+		}
+		if startsIdent(r, t.peek(1), t.peek(2)) {
+			return t.consumeIdentLike()
+		}
+	case r == '<':
+		if t.peek(1) == '!' && t.peek(2) == '-' && t.peek(3) == '-' {
+			t.pos += 4
+			return Token{Type: CDO, Value: "<!--"}
+		}
+	case r == '@':
+		if startsIdent(t.peek(1), t.peek(2), t.peek(3)) {
+			t.pos++
+			return Token{Type: AtKeyword, Value: t.consumeIdentSequence()}
+		}
+	case r == '\\':
+		if isValidEscape(r, t.peek(1)) {
+			return t.consumeIdentLike()
+		}
+	case isDigit(r):
+		return t.consumeNumeric()
+	case isIdentStart(r):
+		return t.consumeIdentLike()
+	}
+	t.pos++
+	return Token{Type: Delim, Value: string(r)}
+}
+
+func (t *tokenizer) consumeString(q rune) Token {
+	sb := strings.Builder{}
+	for {
+		r := t.peek(0)
+		switch {
+		case r == eof:
+			return Token{Type: String, Value: sb.String()}
+		case r == q:
+			t.pos++
+			return Token{Type: String, Value: sb.String()}
+		case isNewline(r):
+			return Token{Type: BadString, Value: sb.String()}
+		case r == '\\':
+			next := t.peek(1)
+			switch {
+			case next == eof:
+				t.pos++
+			case isNewline(next):
+				t.pos += 2
+				if next == '\r' && t.peek(0) == '\n' {
+					t.pos++
+				}
+			default:
+				t.pos++
+				_, _ = sb.WriteRune(t.consumeEscape())
+			}
+		default:
+			t.pos++
+			_, _ = sb.WriteRune(r)
+		}
+	}
+}
+
+func (t *tokenizer) consumeIdentLike() Token {
+	name := t.consumeIdentSequence()
+	if strings.EqualFold(name, "url") && t.peek(0) == '(' {
+		t.pos++
+		for isWhitespace(t.peek(0)) && isWhitespace(t.peek(1)) {
+			t.pos++
+		}
+		r := t.peek(0)
+		if isWhitespace(r) {
+			r = t.peek(1)
+		}
+		if r == '"' || r == '\'' {
+			return Token{Type: Function, Value: name}
+		}
+		return t.consumeURL()
+	}
+	if t.peek(0) == '(' {
+		t.pos++
+		return Token{Type: Function, Value: name}
+	}
+	return Token{Type: Ident, Value: name}
+}
+
+func (t *tokenizer) consumeURL() Token {
+	sb := strings.Builder{}
+	for isWhitespace(t.peek(0)) {
+		t.pos++
+	}
+	for {
+		r := t.consume()
+		switch {
+		case r == ')' || r == eof:
+			return Token{Type: URL, Value: sb.String()}
+		case isWhitespace(r):
+			for isWhitespace(t.peek(0)) {
+				t.pos++
+			}
+			if t.peek(0) == ')' || t.peek(0) == eof {
+				t.consume()
+				return Token{Type: URL, Value: sb.String()}
+			}
+			t.consumeBadURLRemnants()
+			return Token{Type: BadURL, Value: sb.String()}
+		case r == '"' || r == '\'' || r == '(' || isNonPrintable(r):
+			t.consumeBadURLRemnants()
+			return Token{Type: BadURL, Value: sb.String()}
+		case r == '\\':
+			if !isValidEscape(r, t.peek(0)) {
+				t.consumeBadURLRemnants()
+				return Token{Type: BadURL, Value: sb.String()}
+			}
+			_, _ = sb.WriteRune(t.consumeEscape())
+		default:
+			_, _ = sb.WriteRune(r)
+		}
+	}
+}
+
+func (t *tokenizer) consumeBadURLRemnants() {
+	for {
+		r := t.consume()
+		switch {
+		case r == ')' || r == eof:
+			return
+		case isValidEscape(r, t.peek(0)):
+			_ = t.consumeEscape()
+		}
+	}
+}
+
+func (t *tokenizer) consumeNumeric() Token {
+	repr, number, integer := t.consumeNumber()
+	if startsIdent(t.peek(0), t.peek(1), t.peek(2)) {
+		unit := t.consumeIdentSequence()
+		return Token{Type: Dimension, Value: repr, Number: number, Integer: integer, Unit: unit}
+	}
+	if t.peek(0) == '%' {
+		t.pos++
+		return Token{Type: Percentage, Value: repr, Number: number}
+	}
+	return Token{Type: Number, Value: repr, Number: number, Integer: integer}
+}
+
+func (t *tokenizer) consumeNumber() (string, float64, bool) {
+	start := t.pos
+	integer := true
+	if r := t.peek(0); r == '+' || r == '-' {
+		t.pos++
+	}
+	for isDigit(t.peek(0)) {
+		t.pos++
+	}
+	if t.peek(0) == '.' && isDigit(t.peek(1)) {
+		integer = false
+		t.pos += 2
+		for isDigit(t.peek(0)) {
+			t.pos++
+		}
+	}
+	if r := t.peek(0); r == 'e' || r == 'E' {
+		next := t.peek(1)
+		if isDigit(next) || ((next == '+' || next == '-') && isDigit(t.peek(2))) {
+			integer = false
+			t.pos += 2
+			for isDigit(t.peek(0)) {
+				t.pos++
+			}
+		}
+	}
+	repr := string(t.input[start:t.pos])
+	number, _ := strconv.ParseFloat(repr, 64)
+	return repr, number, integer
+}
+
+func (t *tokenizer) consumeIdentSequence() string {
+	sb := strings.Builder{}
+	for {
+		r := t.peek(0)
+		switch {
+		case isIdent(r):
+			t.pos++
+			_, _ = sb.WriteRune(r)
+		case isValidEscape(r, t.peek(1)):
+			t.pos++
+			_, _ = sb.WriteRune(t.consumeEscape())
+		default:
+			return sb.String()
+		}
+	}
+}
+
+// consumeEscape consumes an escaped code point, the reverse solidus must
+// already be consumed.
+func (t *tokenizer) consumeEscape() rune {
+	r := t.consume()
+	if r == eof {
+		return utf8.RuneError
+	}
+	if !isHexDigit(r) {
+		return r
+	}
+	hex := []rune{r}
+	for len(hex) < 6 && isHexDigit(t.peek(0)) {
+		hex = append(hex, t.consume())
+	}
+	if r := t.peek(0); isWhitespace(r) {
+		t.pos++
+		if r == '\r' && t.peek(0) == '\n' {
+			t.pos++
+		}
+	}
+	value, _ := strconv.ParseInt(string(hex), 16, 32)
+	if value == 0 || (value >= 0xd800 && value <= 0xdfff) || value > utf8.MaxRune {
+		return utf8.RuneError
+	}
+	return rune(value)
+}
+
+func isWhitespace(r rune) bool {
+	return r == ' ' || r == '\t' || isNewline(r)
+}
+
+func isNewline(r rune) bool {
+	return r == '\n' || r == '\r' || r == '\f'
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isHexDigit(r rune) bool {
+	return isDigit(r) || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func isIdentStart(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' || r >= 0x80
+}
+
+func isIdent(r rune) bool {
+	return isIdentStart(r) || isDigit(r) || r == '-'
+}
+
+func isNonPrintable(r rune) bool {
+	return (r >= 0 && r <= 0x08) || r == 0x0b || (r >= 0x0e && r <= 0x1f) || r == 0x7f
+}
+
+func isValidEscape(r1, r2 rune) bool {
+	return r1 == '\\' && !isNewline(r2)
+}
+
+func startsIdent(r1, r2, r3 rune) bool {
+	switch {
+	case r1 == '-':
+		return isIdentStart(r2) || r2 == '-' || isValidEscape(r2, r3)
+	case isIdentStart(r1):
+		return true
+	case r1 == '\\':
+		return isValidEscape(r1, r2)
+	default:
+		return false
+	}
+}
+
+func startsNumber(r1, r2, r3 rune) bool {
+	switch {
+	case r1 == '+' || r1 == '-':
+		return isDigit(r2) || (r2 == '.' && isDigit(r3))
+	case r1 == '.':
+		return isDigit(r2)
+	default:
+		return isDigit(r1)
+	}
+}
@@ -0,0 +1,88 @@
+package css_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/css"
+)
+
+func TestTokenize(t *testing.T) {
+	bee := bee.New(t)
+	tests := []struct {
+		input    string
+		expected []css.TokenType
+	}{
+		{`a{color:red}`, []css.TokenType{css.Ident, css.LeftBrace, css.Ident, css.Colon, css.Ident, css.RightBrace}},
+		{`/* url(x) */ "url(y)"`, []css.TokenType{css.Comment, css.Whitespace, css.String}},
+		{`url( x.png )`, []css.TokenType{css.URL}},
+		{`URL("x.png")`, []css.TokenType{css.Function, css.String, css.RightParen}},
+		{`url( 'x.png' )`, []css.TokenType{css.Function, css.Whitespace, css.String, css.Whitespace, css.RightParen}},
+		{`url(a b)`, []css.TokenType{css.BadURL}},
+		{`local(Arial)`, []css.TokenType{css.Function, css.Ident, css.RightParen}},
+		{`#id #1`, []css.TokenType{css.Hash, css.Whitespace, css.Hash}},
+		{`1.5rem 50% -2 +.5e3`, []css.TokenType{css.Dimension, css.Whitespace, css.Percentage, css.Whitespace, css.Number, css.Whitespace, css.Number}},
+		{`@media <!-- -->`, []css.TokenType{css.AtKeyword, css.Whitespace, css.CDO, css.Whitespace, css.CDC}},
+		{"\"unterminated\nx", []css.TokenType{css.BadString, css.Whitespace, css.Ident}},
+		{`\31 0`, []css.TokenType{css.Ident}},
+	}
+	for _, test := range tests {
+		tokens := css.Tokenize(test.input)
+		types := make([]css.TokenType, len(tokens))
+		for i, token := range tokens {
+			types[i] = token.Type
+		}
+		bee.Equal(types, test.expected)
+		bee.Equal(css.Serialize(tokens), test.input)
+	}
+}
+
+func TestTokenizeValues(t *testing.T) {
+	bee := bee.New(t)
+	tokens := css.Tokenize(`url(a\)b.png) "it\'s" \31 0 -1.5e2px #x`)
+	bee.Equal(tokens[0].Value, "a)b.png")
+	bee.Equal(tokens[2].Value, "it's")
+	bee.Equal(tokens[4].Value, "10")
+	bee.Equal(tokens[6].Number, -150.0)
+	bee.Equal(tokens[6].Unit, "px")
+	bee.False(tokens[6].Integer)
+	bee.True(tokens[8].ID)
+}
+
+func TestTokenizeRoundTrip(t *testing.T) {
+	bee := bee.New(t)
+	input := "@font-face{src:url(\"a.woff2\")format('woff2'),local(\"A B\")}\r\n" +
+		".a\\:b::before{content:'\\201C  �';background:url(data:image/png;base64,AAAA)}\x00" +
+		"/* unterminated comment"
+	bee.Equal(css.Serialize(css.Tokenize(input)), input)
+}
+
+func TestRewriteURLs(t *testing.T) {
+	bee := bee.New(t)
+	input := strings.Join([]string{
+		`/* url(comment.png) */`,
+		`a { content: "url(string.png)"; background: URL( 'a.png' ) }`,
+		`b { background: url( b\).png ) }`,
+		`c { background: url(data:image/png;base64,AAAA) }`,
+		`@font-face { src: local("Font"), url("f.woff2") format("woff2") }`,
+	}, "\n")
+	expected := strings.Join([]string{
+		`/* url(comment.png) */`,
+		`a { content: "url(string.png)"; background: URL( 'new:a.png' ) }`,
+		`b { background: url("new:b).png") }`,
+		`c { background: url(data:image/png;base64,AAAA) }`,
+		`@font-face { src: local("Font"), url("new:f.woff2") format("woff2") }`,
+	}, "\n")
+	seen := make([]string, 0)
+	tokens, err := css.RewriteURLs(css.Tokenize(input), func(link string) (string, error) {
+		seen = append(seen, link)
+		if strings.HasPrefix(link, "data:") {
+			return link, nil
+		}
+		return "new:" + link, nil
+	})
+	bee.Nil(err)
+	bee.Equal(seen, []string{"a.png", "b).png", "data:image/png;base64,AAAA", "f.woff2"})
+	bee.Equal(css.Serialize(tokens), expected)
+}
@@ -0,0 +1,45 @@
+package css
+
+// RewriteURLs calls fn with the value of every url() reference in tokens,
+// both in the unquoted url token form and in the url() function form with a
+// string argument, and replaces the reference with the returned value.
+// All other tokens are left untouched.
+func RewriteURLs(tokens []Token, fn func(string) (string, error)) ([]Token, error) {
+	rewritten := make([]Token, len(tokens))
+	copy(rewritten, tokens)
+	for i, token := range rewritten {
+		switch {
+		case token.Type == URL:
+			value, err := fn(token.Value)
+			if err != nil {
+				return nil, err
+			}
+			if value != token.Value {
+				rewritten[i] = NewURL(value)
+			}
+		case token.Is(Function, "url"):
+			j := skipWhitespace(rewritten, i+1)
+			if j >= len(rewritten) || rewritten[j].Type != String {
+				continue
+			}
+			if k := skipWhitespace(rewritten, j+1); k >= len(rewritten) || rewritten[k].Type != RightParen {
+				continue
+			}
+			value, err := fn(rewritten[j].Value)
+			if err != nil {
+				return nil, err
+			}
+			if value != rewritten[j].Value {
+				rewritten[j] = NewString(value, []rune(rewritten[j].Raw)[0])
+			}
+		}
+	}
+	return rewritten, nil
+}
+
+func skipWhitespace(tokens []Token, i int) int {
+	for i < len(tokens) && (tokens[i].Type == Whitespace || tokens[i].Type == Comment) {
+		i++
+	}
+	return i
+}
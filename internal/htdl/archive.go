@@ -3,76 +3,301 @@ package htdl
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/danielrenes/htdl/internal/html"
 	"github.com/danielrenes/htdl/internal/http"
+	"github.com/danielrenes/htdl/internal/text"
 	"github.com/danielrenes/htdl/internal/transform"
 )
 
-func Archive(dir string, link string) error {
-	slog.Info("Processing link", slog.String("link", link))
-	htmlRoot, err := downloadHTML(link)
+type Format int
+
+const (
+	FormatHTML Format = iota
+	FormatText
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatText:
+		return "text"
+	default:
+		return "html"
+	}
+}
+
+func (f Format) extension() string {
+	switch f {
+	case FormatText:
+		return "txt"
+	default:
+		return "html"
+	}
+}
+
+type Options struct {
+	Format         Format
+	TextWidth      int
+	OutputTemplate string
+	Exists         ExistsPolicy
+	Compression    Compression
+	// Manifest writes a JSON manifest next to the file written by Archive.
+	Manifest bool
+	// ManifestWriter receives the JSON manifest from WriteArchive.
+	ManifestWriter io.Writer
+	Styles         transform.StyleOptions
+	Images         transform.ImageOptions
+	Media          transform.MediaOptions
+	// PruneCSS removes the style rules matching no element of the page.
+	PruneCSS transform.PruneMode
+	// Icons inlines the icon of the page, or /favicon.ico if it has none.
+	Icons bool
+	// IconSize selects the smallest icon at least this large, or the
+	// largest icon if it is zero.
+	IconSize int
+	// SVGImages replaces the img elements with SVG sources with the svg
+	// elements.
+	SVGImages bool
+	// MetaImages inlines the images describing the page in its Open Graph,
+	// Twitter card and schema.org metadata.
+	MetaImages bool
+	// Embeds replaces the third-party embeds with static cards.
+	Embeds bool
+	// EmbedRules are the embed rules applied before the default ones.
+	EmbedRules []transform.EmbedRule
+	// PruneFonts removes the font faces no text of the page is rendered with.
+	PruneFonts bool
+	// MinifyCSS minifies the inlined styles.
+	MinifyCSS bool
+}
+
+func (o *Options) extension() string {
+	if o.Compression == CompressionGzip {
+		return o.Format.extension() + ".gz"
+	}
+	return o.Format.extension()
+}
+
+// page is a downloaded page before archiving.
+type page struct {
+	resp *http.Response
+	root *html.Node
+	url  *url.URL
+}
+
+type document struct {
+	root     *html.Node
+	url      *url.URL
+	content  []byte
+	manifest *Manifest
+}
+
+// Archive writes the archived page into dir under a name built from
+// the output template. With the skip policy, a page whose output file
+// already exists is not archived, unless the name depends on the content.
+func Archive(dir string, link string, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	p, err := fetchPage(link)
 	if err != nil {
 		return err
 	}
-	baseURL, err := url.Parse(link)
+	if opts.Exists == ExistsSkip && !templateHasField(opts.OutputTemplate, "hash") {
+		name, err := outputFilename(opts.OutputTemplate, p.root, p.url, nil)
+		if err != nil {
+			return err
+		}
+		path := fmt.Sprintf("%s.%s", filepath.Join(dir, name), opts.extension())
+		if _, err := os.Stat(path); err == nil {
+			slog.Info("Skipping existing file", slog.String("path", path))
+			return nil
+		}
+	}
+	doc, err := archive(p, opts)
 	if err != nil {
-		return fmt.Errorf("parse URL from %s: %w", link, err)
+		return err
 	}
-	pipeline := transform.NewPipeline(
-		transform.Named("resolve links", transform.ResolveLinks(baseURL)),
-		transform.Named("inline styles", transform.InlineStyles(baseURL)),
-		transform.Named("inline images", transform.InlineImages()),
-		transform.Named("remove tags", transform.RemoveTags("style", "link", "script")),
-		transform.Named("append inlined styles", transform.AppendInlinedStyles()),
-	)
-	if err := pipeline.Run(htmlRoot); err != nil {
+	name, err := outputFilename(opts.OutputTemplate, doc.root, doc.url, doc.content)
+	if err != nil {
 		return err
 	}
-	title, err := getTitle(htmlRoot)
+	fp, path, err := createOutputFile(filepath.Join(dir, name), opts.extension(), opts.Exists)
 	if err != nil {
-		return fmt.Errorf("find title element: %w", err)
+		return err
+	}
+	if fp == nil {
+		slog.Info("Skipping existing file", slog.String("path", path))
+		return nil
 	}
-	path := filepath.Join(dir, fmt.Sprintf("%s.html", title))
 	slog.Info("Writing file", slog.String("path", path))
-	if err := saveFile(path, htmlRoot); err != nil {
+	if err := writeFile(fp, doc.content); err != nil {
 		return err
 	}
+	if opts.Manifest {
+		data, err := doc.manifest.marshal()
+		if err != nil {
+			return err
+		}
+		if err := SaveManifest(path, data, opts.Exists); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func downloadHTML(link string) (*html.Node, error) {
-	htmlData, err := http.Download(link)
+// WriteArchive writes the archived page to w. Nothing is written if
+// archiving fails.
+func WriteArchive(w io.Writer, link string, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	p, err := fetchPage(link)
 	if err != nil {
-		return nil, fmt.Errorf("download %s: %w", link, err)
+		return err
 	}
-	htmlRoot, err := html.Parse(bytes.NewReader(htmlData))
+	doc, err := archive(p, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(doc.content); err != nil {
+		return fmt.Errorf("write %s: %w", opts.Format, err)
+	}
+	if opts.ManifestWriter != nil {
+		data, err := doc.manifest.marshal()
+		if err != nil {
+			return err
+		}
+		if _, err := opts.ManifestWriter.Write(data); err != nil {
+			return fmt.Errorf("write manifest: %w", err)
+		}
+	}
+	return nil
+}
+
+// fetchPage downloads and parses the page of the link.
+func fetchPage(link string) (*page, error) {
+	slog.Info("Processing link", slog.String("link", link))
+	resp, htmlRoot, err := downloadHTML(link)
 	if err != nil {
 		return nil, err
 	}
-	return htmlRoot, nil
+	pageURL, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("parse URL from %s: %w", link, err)
+	}
+	return &page{resp: resp, root: htmlRoot, url: pageURL}, nil
 }
 
-func getTitle(node *html.Node) (string, error) {
-	title, err := node.Find(html.IsTag("title"))
+func archive(p *page, opts *Options) (*document, error) {
+	if opts.Compression == CompressionSelfExtracting && opts.Format != FormatHTML {
+		return nil, fmt.Errorf("%s compression requires the %s format", opts.Compression, FormatHTML)
+	}
+	resp, htmlRoot, pageURL := p.resp, p.root, p.url
+	baseURL, err := url.Parse(resp.FinalURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse URL from %s: %w", resp.FinalURL, err)
+	}
+	pipeline := newPipeline(baseURL, opts)
+	if err := pipeline.Run(htmlRoot); err != nil {
+		return nil, err
+	}
+	for _, saving := range pipeline.Context().Savings() {
+		slog.Info("Saved bytes", slog.String("transformer", saving.Transformer), slog.Int("bytes", saving.Bytes))
+	}
+	content := &bytes.Buffer{}
+	if err := render(content, htmlRoot, opts); err != nil {
+		return nil, fmt.Errorf("render %s: %w", opts.Format, err)
+	}
+	compressed, err := compress(content.Bytes(), documentTitle(htmlRoot, pageURL), opts.Compression)
 	if err != nil {
-		return "", fmt.Errorf("find title element: %w", err)
+		return nil, err
 	}
-	return title.Text(), nil
+	return &document{
+		root:     htmlRoot,
+		url:      pageURL,
+		content:  compressed,
+		manifest: newManifest(resp, pipeline.Context()),
+	}, nil
 }
 
-func saveFile(path string, node *html.Node) error {
-	fp, err := os.Create(path)
+func newPipeline(baseURL *url.URL, opts *Options) *transform.Pipeline {
+	if opts.Format == FormatText {
+		return transform.NewPipeline(
+			transform.Named("resolve links", transform.ResolveLinks(baseURL)),
+		)
+	}
+	transformers := []transform.Transformer{
+		transform.Named("resolve lazy images", transform.ResolveLazyImages(opts.Images)),
+		transform.Named("resolve links", transform.ResolveLinks(baseURL)),
+		transform.Named("preload links", transform.PreloadLinks()),
+		transform.Named("inline styles", transform.InlineStyles(baseURL, opts.Styles)),
+		transform.Named("inline style attributes", transform.InlineStyleAttributes(baseURL, opts.Styles)),
+		transform.Named("inline svg", transform.InlineSVG(baseURL, opts.SVGImages)),
+		transform.Named("inline images", transform.InlineImages(opts.Images)),
+		transform.Named("inline media", transform.InlineMedia(opts.Media)),
+	}
+	if opts.MetaImages {
+		transformers = append(transformers, transform.Named("inline meta images", transform.InlineMetaImages(baseURL, opts.Images)))
+	}
+	if opts.Embeds {
+		rules := append(slices.Clone(opts.EmbedRules), transform.DefaultEmbedRules...)
+		transformers = append(transformers, transform.Named("replace embeds", transform.ReplaceEmbeds(baseURL, rules, opts.Images)))
+	}
+	if opts.Icons {
+		transformers = append(transformers, transform.Named("inline icons", transform.InlineIcons(baseURL, opts.IconSize)))
+	}
+	transformers = append(
+		transformers,
+		transform.Named("deduplicate images", transform.DeduplicateImages()),
+		transform.Named("remove tags", transform.RemoveTags("script")),
+		transform.Named("remove links", transform.RemoveLinks()),
+	)
+	if opts.PruneCSS != transform.PruneNone {
+		transformers = append(transformers, transform.Named("prune styles", transform.PruneStyles(opts.PruneCSS)))
+	}
+	if opts.PruneFonts {
+		transformers = append(transformers, transform.Named("prune fonts", transform.PruneFonts()))
+	}
+	if opts.MinifyCSS {
+		transformers = append(transformers, transform.Named("minify styles", transform.MinifyStyles()))
+	}
+	return transform.NewPipeline(transformers...)
+}
+
+func downloadHTML(link string) (*http.Response, *html.Node, error) {
+	resp, err := http.Fetch(link)
 	if err != nil {
-		return fmt.Errorf("create %s: %w", path, err)
+		return nil, nil, fmt.Errorf("download %s: %w", link, err)
 	}
-	defer fp.Close()
-	if err := node.Render(fp); err != nil {
-		return fmt.Errorf("render HTML to %s: %w", path, err)
+	htmlRoot, err := html.Parse(bytes.NewReader(resp.Data))
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, htmlRoot, nil
+}
+
+// writeFile writes the data to the created file and closes it.
+func writeFile(fp *os.File, data []byte) error {
+	if _, err := fp.Write(data); err != nil {
+		_ = fp.Close()
+		return fmt.Errorf("write %s: %w", fp.Name(), err)
+	}
+	if err := fp.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", fp.Name(), err)
 	}
 	return nil
 }
+
+func render(w io.Writer, node *html.Node, opts *Options) error {
+	if opts.Format == FormatText {
+		return text.Render(w, node, opts.TextWidth)
+	}
+	return node.Render(w)
+}
@@ -1,9 +1,18 @@
 package htdl_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -12,6 +21,7 @@ import (
 	"github.com/danielrenes/bee"
 	"github.com/danielrenes/htdl/internal/htdl"
 	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
 )
 
 func TestArchive(t *testing.T) {
@@ -21,14 +31,15 @@ func TestArchive(t *testing.T) {
 <html>
     <head>
         <title>index</title>
+        <style>@font-face {
+                font-family: 'MyFont';
+                src: url('data:font/ttf;base64,%s') format('truetype');
+            }
+        </style>
         <style>
             .subtitle {
                 font-size: 1.5rem;
             }
-            @font-face {
-                font-family: 'MyFont';
-                src: url(data:font/ttf;base64,%s) format('truetype');
-            }
         </style>
     </head>
     <body>
@@ -39,21 +50,14 @@ func TestArchive(t *testing.T) {
     </body>
 </html>
 `)
-	fs := http.FileServer(http.Dir("testdata/server"))
-	srv := http.Server{Addr: ":8000", Handler: fs}
-	go func() {
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-			t.Logf("run server: %v", err)
-		}
-	}()
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata/server")))
+	defer srv.Close()
 	b64Font, err := os.ReadFile("testdata/base64/font.b64")
 	bee.Nil(err)
 	b64Image, err := os.ReadFile("testdata/base64/img.b64")
 	bee.Nil(err)
-	outDir := filepath.Join(os.TempDir(), "out")
-	err = os.MkdirAll(outDir, 0755)
-	bee.Nil(err)
-	err = htdl.Archive(outDir, "http://localhost:8000/index.html")
+	outDir := t.TempDir()
+	err = htdl.Archive(outDir, srv.URL+"/index.html", nil)
 	bee.Nil(err)
 	entries, err := os.ReadDir(outDir)
 	bee.Nil(err)
@@ -61,10 +65,173 @@ func TestArchive(t *testing.T) {
 	data, err := os.ReadFile(filepath.Join(outDir, "index.html"))
 	bee.Nil(err)
 	bee.Equal(renderHTML(bee, string(data)), renderHTML(bee, fmt.Sprintf(expected, b64Font, b64Image)))
-	err = os.RemoveAll(outDir)
+}
+
+func TestArchiveText(t *testing.T) {
+	bee := bee.New(t)
+	expected := "index\n=====\n\n## abc\n"
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata/server")))
+	defer srv.Close()
+	outDir := t.TempDir()
+	err := htdl.Archive(outDir, srv.URL+"/index.html", &htdl.Options{Format: htdl.FormatText})
+	bee.Nil(err)
+	data, err := os.ReadFile(filepath.Join(outDir, "index.txt"))
+	bee.Nil(err)
+	bee.Equal(string(data), expected)
+}
+
+func TestWriteArchive(t *testing.T) {
+	bee := bee.New(t)
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata/server")))
+	defer srv.Close()
+	sb := &strings.Builder{}
+	err := htdl.WriteArchive(sb, srv.URL+"/index.html", &htdl.Options{Format: htdl.FormatText})
+	bee.Nil(err)
+	bee.Equal(sb.String(), "index\n=====\n\n## abc\n")
+	sb.Reset()
+	err = htdl.WriteArchive(sb, srv.URL+"/missing.html", nil)
+	bee.NotNil(err)
+	bee.Equal(sb.Len(), 0)
+}
+
+func TestWriteArchiveCompressed(t *testing.T) {
+	bee := bee.New(t)
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata/server")))
+	defer srv.Close()
+	link := srv.URL + "/index.html"
+	plain := &bytes.Buffer{}
+	err := htdl.WriteArchive(plain, link, nil)
+	bee.Nil(err)
+
+	gzipped := &bytes.Buffer{}
+	err = htdl.WriteArchive(gzipped, link, &htdl.Options{Compression: htdl.CompressionGzip})
+	bee.Nil(err)
+	bee.Equal(gunzip(bee, gzipped.Bytes()), plain.String())
+
+	shell := &bytes.Buffer{}
+	err = htdl.WriteArchive(shell, link, &htdl.Options{Compression: htdl.CompressionSelfExtracting})
+	bee.Nil(err)
+	root, err := html.Parse(shell)
+	bee.Nil(err)
+	title, err := root.Find(html.IsTag("title"))
+	bee.Nil(err)
+	bee.Equal(title.Text(), "index")
+	script, err := root.Find(html.HasID("htdl-payload"))
+	bee.Nil(err)
+	payload, err := base64.StdEncoding.DecodeString(script.Text())
+	bee.Nil(err)
+	bee.Equal(gunzip(bee, payload), plain.String())
+
+	err = htdl.WriteArchive(shell, link, &htdl.Options{Format: htdl.FormatText, Compression: htdl.CompressionSelfExtracting})
+	bee.NotNil(err)
+}
+
+func TestArchiveGzip(t *testing.T) {
+	bee := bee.New(t)
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata/server")))
+	defer srv.Close()
+	outDir := t.TempDir()
+	opts := &htdl.Options{Format: htdl.FormatText, Compression: htdl.CompressionGzip}
+	for range 2 {
+		err := htdl.Archive(outDir, srv.URL+"/index.html", opts)
+		bee.Nil(err)
+	}
+	for _, name := range []string{"index.txt.gz", "index-1.txt.gz"} {
+		data, err := os.ReadFile(filepath.Join(outDir, name))
+		bee.Nil(err)
+		bee.Equal(gunzip(bee, data), "index\n=====\n\n## abc\n")
+	}
+}
+
+func TestArchiveSkipExisting(t *testing.T) {
+	bee := bee.New(t)
+	requests := make(map[string]int)
+	files := http.FileServer(http.Dir("testdata/server"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		files.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	outDir := t.TempDir()
+	err := htdl.Archive(outDir, srv.URL+"/index.html", nil)
+	bee.Nil(err)
+	bee.Equal(requests["/img.png"], 1)
+	err = htdl.Archive(outDir, srv.URL+"/index.html", &htdl.Options{Exists: htdl.ExistsSkip})
+	bee.Nil(err)
+	bee.Equal(requests["/img.png"], 1)
+	entries, err := os.ReadDir(outDir)
+	bee.Nil(err)
+	bee.Equal(len(entries), 1)
+	err = htdl.Archive(outDir, srv.URL+"/index.html", &htdl.Options{OutputTemplate: "{title}-{hash}", Exists: htdl.ExistsSkip})
+	bee.Nil(err)
+	bee.Equal(requests["/img.png"], 2)
+}
+
+func TestArchiveManifest(t *testing.T) {
+	bee := bee.New(t)
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata/server")))
+	defer srv.Close()
+	outDir := t.TempDir()
+	err := htdl.Archive(outDir, srv.URL+"/index.html", &htdl.Options{Manifest: true})
+	bee.Nil(err)
+	data, err := os.ReadFile(filepath.Join(outDir, "index.json"))
+	bee.Nil(err)
+	manifest := htdl.Manifest{}
+	err = json.Unmarshal(data, &manifest)
+	bee.Nil(err)
+	bee.Equal(manifest.SourceURL, srv.URL+"/index.html")
+	bee.Equal(manifest.FinalURL, srv.URL+"/")
+	bee.Equal(manifest.Status, http.StatusOK)
+	bee.False(manifest.FetchedAt.IsZero())
+	expected := []transform.Resource{
+		{URL: srv.URL + "/style.css", MIMEType: "text/css", Transformer: "inline styles"},
+		{URL: srv.URL + "/font.ttf", MIMEType: "font/ttf", Transformer: "inline styles"},
+		{URL: srv.URL + "/img.png", MIMEType: "image/png", Transformer: "inline images"},
+	}
+	for i := range expected {
+		data, err := os.ReadFile(filepath.Join("testdata/server", path.Base(expected[i].URL)))
+		bee.Nil(err)
+		hash := sha256.Sum256(data)
+		expected[i].Size = len(data)
+		expected[i].SHA256 = hex.EncodeToString(hash[:])
+	}
+	bee.Equal(manifest.Resources, expected)
+}
+
+func TestSaveManifest(t *testing.T) {
+	bee := bee.New(t)
+	outDir := t.TempDir()
+	for path, expected := range map[string]string{
+		"page.html.gz": "page.json",
+		"page.txt":     "page.json",
+		"page.htm":     "page.json",
+		"page":         "page.json",
+	} {
+		bee.Equal(htdl.ManifestPath(path), expected)
+	}
+	archivePath := filepath.Join(outDir, "page.html")
+	err := htdl.SaveManifest(archivePath, []byte("first"), htdl.ExistsSuffix)
+	bee.Nil(err)
+	err = htdl.SaveManifest(archivePath, []byte("second"), htdl.ExistsSkip)
+	bee.Nil(err)
+	err = htdl.SaveManifest(archivePath, []byte("third"), htdl.ExistsSuffix)
+	bee.Nil(err)
+	data, err := os.ReadFile(filepath.Join(outDir, "page.json"))
+	bee.Nil(err)
+	bee.Equal(string(data), "first")
+	data, err = os.ReadFile(filepath.Join(outDir, "page-1.json"))
+	bee.Nil(err)
+	bee.Equal(string(data), "third")
+	err = htdl.SaveManifest(filepath.Join(outDir, "page.json"), []byte("{}"), htdl.ExistsOverwrite)
+	bee.NotNil(err)
+}
+
+func gunzip(bee *bee.Bee, data []byte) string {
+	r, err := gzip.NewReader(bytes.NewReader(data))
 	bee.Nil(err)
-	err = srv.Close()
+	decompressed, err := io.ReadAll(r)
 	bee.Nil(err)
+	return string(decompressed)
 }
 
 func renderHTML(bee *bee.Bee, s string) string {
@@ -0,0 +1,86 @@
+package htdl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"text/template"
+)
+
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionSelfExtracting
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionSelfExtracting:
+		return "self-extracting"
+	default:
+		return "none"
+	}
+}
+
+// selfExtractingShell is a minimal HTML document which decompresses the
+// gzipped, base64 encoded payload in the browser and replaces itself with
+// the result.
+const selfExtractingShell = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+</head>
+<body>
+<noscript>This archive is compressed and needs JavaScript to be displayed.</noscript>
+<script id="htdl-payload" type="application/gzip;base64">%s</script>
+<script>
+(async () => {
+    const payload = document.getElementById("htdl-payload").textContent;
+    const bytes = Uint8Array.from(atob(payload), (c) => c.charCodeAt(0));
+    const stream = new Blob([bytes]).stream().pipeThrough(new DecompressionStream("gzip"));
+    const html = await new Response(stream).text();
+    document.open();
+    document.write(html);
+    document.close();
+})();
+</script>
+</body>
+</html>
+`
+
+func compress(data []byte, title string, compression Compression) ([]byte, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzipData(data)
+	case CompressionSelfExtracting:
+		compressed, err := gzipData(data)
+		if err != nil {
+			return nil, err
+		}
+		payload := base64.StdEncoding.EncodeToString(compressed)
+		return fmt.Appendf(nil, selfExtractingShell, template.HTMLEscapeString(title), payload), nil
+	default:
+		return data, nil
+	}
+}
+
+func gzipData(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return nil, fmt.Errorf("create gzip writer: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	return buf.Bytes(), nil
+}
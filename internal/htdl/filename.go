@@ -0,0 +1,183 @@
+package htdl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+const (
+	DefaultOutputTemplate = "{title}"
+
+	maxFilenameLength = 200
+)
+
+var (
+	templateFieldPattern = regexp.MustCompile(`\{([a-z]+)\}`)
+	reservedFilenames    = []string{
+		"CON", "PRN", "AUX", "NUL",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+	}
+)
+
+type ExistsPolicy int
+
+const (
+	ExistsSuffix ExistsPolicy = iota
+	ExistsOverwrite
+	ExistsSkip
+)
+
+func (p ExistsPolicy) String() string {
+	switch p {
+	case ExistsOverwrite:
+		return "overwrite"
+	case ExistsSkip:
+		return "skip"
+	default:
+		return "suffix"
+	}
+}
+
+func outputFilename(tmpl string, root *html.Node, pageURL *url.URL, content []byte) (string, error) {
+	if len(tmpl) == 0 {
+		tmpl = DefaultOutputTemplate
+	}
+	hash := sha256.Sum256(content)
+	fields := map[string]string{
+		"title": documentTitle(root, pageURL),
+		"host":  pageURL.Hostname(),
+		"path":  strings.Trim(pageURL.Path, "/"),
+		"date":  time.Now().Format(time.DateOnly),
+		"hash":  hex.EncodeToString(hash[:])[:12],
+	}
+	var errs []error
+	name := templateFieldPattern.ReplaceAllStringFunc(tmpl, func(field string) string {
+		value, ok := fields[field[1:len(field)-1]]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown output template field %s", field))
+		}
+		return sanitizeFilename(value)
+	})
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	segments := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})
+	for i, segment := range segments {
+		segments[i] = sanitizeFilename(segment)
+	}
+	segments = slices.DeleteFunc(segments, func(segment string) bool {
+		return len(segment) == 0
+	})
+	if len(segments) == 0 {
+		return "", fmt.Errorf("output template %s expands to an empty filename", tmpl)
+	}
+	return filepath.Join(segments...), nil
+}
+
+// templateHasField reports whether the output template refers to the field.
+func templateHasField(tmpl string, field string) bool {
+	if len(tmpl) == 0 {
+		tmpl = DefaultOutputTemplate
+	}
+	for _, match := range templateFieldPattern.FindAllStringSubmatch(tmpl, -1) {
+		if match[1] == field {
+			return true
+		}
+	}
+	return false
+}
+
+// documentTitle returns the text of the title element, falling back to the
+// first h1 element and then to the last segment of the URL path.
+func documentTitle(root *html.Node, pageURL *url.URL) string {
+	for _, tag := range []string{"title", "h1"} {
+		if node, err := root.Find(html.IsTag(tag)); err == nil {
+			if title := strings.Join(strings.Fields(node.TextContent()), " "); len(title) > 0 {
+				return title
+			}
+		}
+	}
+	slug := path.Base(strings.TrimRight(pageURL.Path, "/"))
+	if slug == "." || slug == "/" || len(slug) == 0 {
+		return pageURL.Hostname()
+	}
+	return strings.TrimSuffix(slug, path.Ext(slug))
+}
+
+// sanitizeFilename makes s usable as a single path segment on Linux, macOS
+// and Windows filesystems.
+func sanitizeFilename(s string) string {
+	sb := strings.Builder{}
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			_, _ = sb.WriteRune(' ')
+		case r == utf8.RuneError, unicode.IsControl(r), strings.ContainsRune(`<>:"/\|?*`, r):
+			_, _ = sb.WriteRune('_')
+		default:
+			_, _ = sb.WriteRune(r)
+		}
+	}
+	name := strings.Join(strings.Fields(sb.String()), " ")
+	name = strings.Trim(name, " .")
+	if len(name) > maxFilenameLength {
+		name = name[:maxFilenameLength]
+		for !utf8.ValidString(name) {
+			name = name[:len(name)-1]
+		}
+		name = strings.TrimRight(name, " .")
+	}
+	stem, _, _ := strings.Cut(name, ".")
+	for _, reserved := range reservedFilenames {
+		if strings.EqualFold(stem, reserved) {
+			return "_" + name
+		}
+	}
+	return name
+}
+
+// createOutputFile creates the file at stem.ext, applying the policy to an
+// already existing file. Files are created exclusively, so a file another
+// writer creates in the meantime is never overwritten by the suffix or skip
+// policies. It returns a nil file if nothing should be written.
+func createOutputFile(stem string, ext string, policy ExistsPolicy) (*os.File, string, error) {
+	if err := os.MkdirAll(filepath.Dir(stem), 0755); err != nil {
+		return nil, "", fmt.Errorf("create directory for %s: %w", stem, err)
+	}
+	path := fmt.Sprintf("%s.%s", stem, ext)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if policy == ExistsOverwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	for i := 1; ; i++ {
+		fp, err := os.OpenFile(path, flags, 0644)
+		if err == nil {
+			return fp, path, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, "", fmt.Errorf("create %s: %w", path, err)
+		}
+		if policy == ExistsSkip {
+			return nil, path, nil
+		}
+		path = fmt.Sprintf("%s-%d.%s", stem, i, ext)
+	}
+}
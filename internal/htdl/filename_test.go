@@ -0,0 +1,87 @@
+package htdl
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	bee := bee.New(t)
+	tests := map[string]string{
+		"index":                  "index",
+		"a/b: c?":                "a_b_ c_",
+		"  spaced\t\ttitle  ":    "spaced title",
+		"trailing dots...":       "trailing dots",
+		"CON":                    "_CON",
+		"nul.txt":                "_nul.txt",
+		"control\x00char":        "control_char",
+		strings.Repeat("é", 150): strings.Repeat("é", 100),
+	}
+	for input, expected := range tests {
+		bee.Equal(sanitizeFilename(input), expected)
+	}
+}
+
+func TestOutputFilename(t *testing.T) {
+	bee := bee.New(t)
+	pageURL, err := url.Parse("https://example.com/blog/my-post.html")
+	bee.Nil(err)
+	tests := []struct {
+		doc      string
+		tmpl     string
+		expected string
+	}{
+		{`<title>A/B</title>`, "", "A_B"},
+		{`<title> </title><h1>Heading <span>text</span></h1>`, "{title}", "Heading text"},
+		{`<p>no title</p>`, "{title}", "my-post"},
+		{`<title>T</title>`, "{host}/{path}", filepath.Join("example.com", "blog_my-post.html")},
+		{`<title>T</title>`, "../{title}", "T"},
+	}
+	for _, test := range tests {
+		root, err := html.Parse(strings.NewReader(test.doc))
+		bee.Nil(err)
+		name, err := outputFilename(test.tmpl, root, pageURL, nil)
+		bee.Nil(err)
+		bee.Equal(name, test.expected)
+	}
+	root, err := html.Parse(strings.NewReader(""))
+	bee.Nil(err)
+	_, err = outputFilename("{unknown}", root, pageURL, nil)
+	bee.NotNil(err)
+}
+
+func TestCreateOutputFile(t *testing.T) {
+	bee := bee.New(t)
+	stem := filepath.Join(t.TempDir(), "index")
+	path := stem + ".html.gz"
+	fp, created, err := createOutputFile(stem, "html.gz", ExistsSuffix)
+	bee.Nil(err)
+	bee.Equal(created, path)
+	bee.Nil(fp.Close())
+	fp, created, err = createOutputFile(stem, "html.gz", ExistsSuffix)
+	bee.Nil(err)
+	bee.Equal(filepath.Base(created), "index-1.html.gz")
+	bee.Nil(fp.Close())
+	fp, created, err = createOutputFile(stem, "html.gz", ExistsSuffix)
+	bee.Nil(err)
+	bee.Equal(filepath.Base(created), "index-2.html.gz")
+	bee.Nil(fp.Close())
+	err = os.WriteFile(path, []byte("old"), 0644)
+	bee.Nil(err)
+	fp, created, err = createOutputFile(stem, "html.gz", ExistsOverwrite)
+	bee.Nil(err)
+	bee.Equal(created, path)
+	bee.Nil(fp.Close())
+	data, err := os.ReadFile(path)
+	bee.Nil(err)
+	bee.Equal(len(data), 0)
+	fp, _, err = createOutputFile(stem, "html.gz", ExistsSkip)
+	bee.Nil(err)
+	bee.True(fp == nil)
+}
@@ -0,0 +1,80 @@
+package htdl
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/danielrenes/htdl/internal/http"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+// Manifest describes the archived page and every resource which was
+// inlined into it or skipped.
+type Manifest struct {
+	SourceURL string               `json:"sourceUrl"`
+	FinalURL  string               `json:"finalUrl"`
+	FetchedAt time.Time            `json:"fetchedAt"`
+	Status    int                  `json:"status"`
+	Resources []transform.Resource `json:"resources"`
+	Savings   []transform.Saving   `json:"savings,omitempty"`
+}
+
+func newManifest(resp *http.Response, ctx *transform.TransformerContext) *Manifest {
+	resources := ctx.Resources()
+	if resources == nil {
+		resources = []transform.Resource{}
+	}
+	return &Manifest{
+		SourceURL: resp.URL,
+		FinalURL:  resp.FinalURL,
+		FetchedAt: resp.FetchedAt,
+		Status:    resp.StatusCode,
+		Resources: resources,
+		Savings:   ctx.Savings(),
+	}
+}
+
+func (m *Manifest) marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal manifest: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// ManifestPath returns the path of the manifest written next to the archive
+// at path, which replaces the extensions of the output formats, like
+// .html.gz, or else the last extension with .json.
+func ManifestPath(path string) string {
+	for _, format := range []Format{FormatHTML, FormatText} {
+		for _, ext := range []string{format.extension() + ".gz", format.extension()} {
+			if stem, ok := strings.CutSuffix(path, "."+ext); ok {
+				return stem + ".json"
+			}
+		}
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+}
+
+// SaveManifest writes the manifest of the archive at path next to it,
+// applying the policy to an already existing manifest.
+func SaveManifest(path string, data []byte, policy ExistsPolicy) error {
+	manifestPath := ManifestPath(path)
+	if manifestPath == path {
+		return fmt.Errorf("manifest path %s is the output path", manifestPath)
+	}
+	fp, manifestPath, err := createOutputFile(strings.TrimSuffix(manifestPath, ".json"), "json", policy)
+	if err != nil {
+		return err
+	}
+	if fp == nil {
+		slog.Info("Skipping existing manifest", slog.String("path", manifestPath))
+		return nil
+	}
+	slog.Info("Writing manifest", slog.String("path", manifestPath))
+	return writeFile(fp, data)
+}
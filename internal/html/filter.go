@@ -15,6 +15,23 @@ func (f NodeFilterFunc) Eval(node *Node) bool {
 	return f(node)
 }
 
+func Or(filters ...NodeFilter) NodeFilter {
+	return NodeFilterFunc(func(node *Node) bool {
+		for _, filter := range filters {
+			if filter.Eval(node) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func And(filters ...NodeFilter) NodeFilter {
+	return NodeFilterFunc(func(node *Node) bool {
+		return node.eval(filters...)
+	})
+}
+
 func Not(filter NodeFilter) NodeFilter {
 	return NodeFilterFunc(func(node *Node) bool {
 		return !filter.Eval(node)
@@ -38,6 +55,16 @@ func HasClass(class string) NodeFilter {
 	})
 }
 
+// HasToken matches nodes whose attribute is a whitespace separated list
+// of tokens containing token, ignoring ASCII case, like the rel attribute.
+func HasToken(name, token string) NodeFilter {
+	return HasAttrFunc(name, func(s string) bool {
+		return slices.ContainsFunc(strings.Fields(s), func(t string) bool {
+			return strings.EqualFold(t, token)
+		})
+	})
+}
+
 func HasAttr(name, value string) NodeFilter {
 	return NodeFilterFunc(func(node *Node) bool {
 		v, ok := node.GetAttr(name)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"iter"
+	"maps"
 	"slices"
 	"strings"
 
@@ -17,8 +18,8 @@ type Node struct {
 
 func NewNode(tag string, attrs map[string]string, text string) *Node {
 	attr := make([]html.Attribute, 0, len(attrs))
-	for key, value := range attrs {
-		attr = append(attr, html.Attribute{Key: key, Val: value})
+	for _, key := range slices.Sorted(maps.Keys(attrs)) {
+		attr = append(attr, html.Attribute{Key: key, Val: attrs[key]})
 	}
 	node := &html.Node{
 		Type: html.ElementNode,
@@ -26,7 +27,7 @@ func NewNode(tag string, attrs map[string]string, text string) *Node {
 		Attr: attr,
 	}
 	if len(text) > 0 {
-		node.FirstChild = &html.Node{Type: html.TextNode, Data: text}
+		node.AppendChild(&html.Node{Type: html.TextNode, Data: text})
 	}
 	return &Node{node: node}
 }
@@ -39,6 +40,20 @@ func Parse(r io.Reader) (*Node, error) {
 	return &Node{root}, nil
 }
 
+// ParseFragment parses the HTML fragment in the context of the element, like
+// the text of a noscript element in the context of its parent.
+func ParseFragment(s string, context *Node) ([]*Node, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(s), context.node)
+	if err != nil {
+		return nil, fmt.Errorf("parse HTML fragment: %w", err)
+	}
+	wrapped := make([]*Node, len(nodes))
+	for i, node := range nodes {
+		wrapped[i] = &Node{node}
+	}
+	return wrapped, nil
+}
+
 func (n *Node) Render(w io.Writer) error {
 	err := html.Render(w, n.node)
 	if err != nil {
@@ -57,13 +72,35 @@ func (n *Node) Tag() string {
 	return n.node.Data
 }
 
+func (n *Node) IsText() bool {
+	return n.node.Type == html.TextNode
+}
+
+func (n *Node) IsElement() bool {
+	return n.node.Type == html.ElementNode
+}
+
 func (n *Node) Text() string {
+	if n.node.Type == html.TextNode {
+		return n.node.Data
+	}
 	if n.node.FirstChild == nil || n.node.FirstChild.Type != html.TextNode {
 		return ""
 	}
 	return n.node.FirstChild.Data
 }
 
+func (n *Node) TextContent() string {
+	if n.node.Type == html.TextNode {
+		return n.node.Data
+	}
+	sb := strings.Builder{}
+	for _, child := range n.Children() {
+		_, _ = sb.WriteString(child.TextContent())
+	}
+	return sb.String()
+}
+
 func (n *Node) GetAttr(name string) (string, bool) {
 	idx := slices.IndexFunc(n.node.Attr, func(attr html.Attribute) bool {
 		return attr.Key == name
@@ -84,6 +121,41 @@ func (n *Node) DeleteAttr(name string) {
 	})
 }
 
+// AttrNames returns the names of the attributes of the element in order,
+// without the namespace prefix, like href for xlink:href.
+func (n *Node) AttrNames() []string {
+	names := make([]string, len(n.node.Attr))
+	for i, attr := range n.node.Attr {
+		names[i] = attr.Key
+	}
+	return names
+}
+
+// ReplaceAttr sets the value of the attributes with the name in place,
+// keeping their position and namespace.
+func (n *Node) ReplaceAttr(name string, value string) {
+	for i, attr := range n.node.Attr {
+		if attr.Key == name {
+			n.node.Attr[i].Val = value
+		}
+	}
+}
+
+// Clone returns a deep copy of the node without a parent.
+func (n *Node) Clone() *Node {
+	clone := &html.Node{
+		Type:      n.node.Type,
+		DataAtom:  n.node.DataAtom,
+		Data:      n.node.Data,
+		Namespace: n.node.Namespace,
+		Attr:      slices.Clone(n.node.Attr),
+	}
+	for child := n.node.FirstChild; child != nil; child = child.NextSibling {
+		clone.AppendChild((&Node{child}).Clone().node)
+	}
+	return &Node{clone}
+}
+
 func (n *Node) Children() []*Node {
 	children := make([]*Node, 0)
 	for child := n.node.FirstChild; child != nil; child = child.NextSibling {
@@ -92,10 +164,60 @@ func (n *Node) Children() []*Node {
 	return children
 }
 
+func (n *Node) Parent() *Node {
+	return wrap(n.node.Parent)
+}
+
+func (n *Node) PrevSibling() *Node {
+	return wrap(n.node.PrevSibling)
+}
+
+func (n *Node) NextSibling() *Node {
+	return wrap(n.node.NextSibling)
+}
+
+func wrap(node *html.Node) *Node {
+	if node == nil {
+		return nil
+	}
+	return &Node{node}
+}
+
+func (n *Node) SetText(text string) {
+	for n.node.FirstChild != nil {
+		n.node.RemoveChild(n.node.FirstChild)
+	}
+	if len(text) > 0 {
+		n.node.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+	}
+}
+
 func (n *Node) AppendChild(child *Node) {
 	n.node.AppendChild(child.node)
 }
 
+func (n *Node) ReplaceWith(node *Node) {
+	parent := n.node.Parent
+	if parent == nil {
+		return
+	}
+	parent.InsertBefore(node.node, n.node)
+	parent.RemoveChild(n.node)
+}
+
+// InsertBefore inserts the node as the previous sibling of n.
+func (n *Node) InsertBefore(node *Node) {
+	if parent := n.node.Parent; parent != nil {
+		parent.InsertBefore(node.node, n.node)
+	}
+}
+
+func (n *Node) Remove() {
+	if parent := n.node.Parent; parent != nil {
+		parent.RemoveChild(n.node)
+	}
+}
+
 func (n *Node) RemoveAll(filters ...NodeFilter) {
 	for matchingNode := range n.FindAll(filters...) {
 		parent := matchingNode.node.Parent
@@ -84,6 +84,66 @@ func TestRemoveAll(t *testing.T) {
 	bee.Equal(len(section.Children()), 0)
 }
 
+func TestReplaceWith(t *testing.T) {
+	bee := bee.New(t)
+	s := `<div><link href="a.css"/><p>text</p></div>`
+	root, err := html.Parse(strings.NewReader(s))
+	bee.Nil(err)
+	link, err := root.Find(html.IsTag("link"))
+	bee.Nil(err)
+	link.ReplaceWith(html.NewNode("style", map[string]string{"media": "print", "title": "a"}, "a {}"))
+	div, err := root.Find(html.IsTag("div"))
+	bee.Nil(err)
+	bee.Equal(div.RenderString(), `<div><style media="print" title="a">a {}</style><p>text</p></div>`)
+	p, err := root.Find(html.IsTag("p"))
+	bee.Nil(err)
+	p.SetText("new text")
+	bee.Equal(p.Text(), "new text")
+	p.Remove()
+	bee.Equal(len(div.Children()), 1)
+}
+
+func TestSiblings(t *testing.T) {
+	bee := bee.New(t)
+	s := `<div><h1>title</h1>text<p>paragraph</p></div>`
+	root, err := html.Parse(strings.NewReader(s))
+	bee.Nil(err)
+	p, err := root.Find(html.IsTag("p"))
+	bee.Nil(err)
+	bee.Equal(p.Parent().Tag(), "div")
+	bee.True(p.PrevSibling().IsText())
+	bee.Equal(p.PrevSibling().PrevSibling().Tag(), "h1")
+	bee.True(p.NextSibling() == nil)
+	bee.True(p.PrevSibling().PrevSibling().PrevSibling() == nil)
+}
+
+func TestHasToken(t *testing.T) {
+	bee := bee.New(t)
+	s := `<link rel="Alternate  stylesheet" href="a.css"/><link rel="stylesheets" href="b.css"/>`
+	root, err := html.Parse(strings.NewReader(s))
+	bee.Nil(err)
+	links := slices.Collect(root.FindAll(html.HasToken("rel", "stylesheet")))
+	bee.Equal(len(links), 1)
+	attrEqual(bee, links[0], "href", "a.css")
+}
+
+func TestClone(t *testing.T) {
+	bee := bee.New(t)
+	s := `<svg><use xlink:href="a.svg#x" class="icon"></use></svg>`
+	root, err := html.Parse(strings.NewReader(s))
+	bee.Nil(err)
+	svg, err := root.Find(html.IsTag("svg"))
+	bee.Nil(err)
+	clone := svg.Clone()
+	use, err := clone.Find(html.IsTag("use"))
+	bee.Nil(err)
+	bee.Equal(use.AttrNames(), []string{"href", "class"})
+	use.ReplaceAttr("href", "#x")
+	bee.Equal(clone.RenderString(), `<svg><use xlink:href="#x" class="icon"></use></svg>`)
+	bee.Equal(svg.RenderString(), `<svg><use xlink:href="a.svg#x" class="icon"></use></svg>`)
+	bee.Equal(clone.Parent(), (*html.Node)(nil))
+}
+
 func attrEqual(bee *bee.Bee, node *html.Node, name, value string) {
 	attr, ok := node.GetAttr(name)
 	bee.True(ok)
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -8,8 +9,37 @@ import (
 	"time"
 )
 
+// ErrTooLarge is returned by FetchLimited for responses larger than the
+// limit.
+var ErrTooLarge = errors.New("response too large")
+
+type Response struct {
+	URL         string
+	FinalURL    string
+	StatusCode  int
+	ContentType string
+	FetchedAt   time.Time
+	Data        []byte
+}
+
 func Download(link string) ([]byte, error) {
+	resp, err := Fetch(link)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+func Fetch(link string) (*Response, error) {
+	return FetchLimited(link, -1)
+}
+
+// FetchLimited fetches the link like Fetch, but stops with ErrTooLarge as
+// soon as the Content-Length or the body exceeds maxSize bytes. A negative
+// maxSize means no limit.
+func FetchLimited(link string, maxSize int) (*Response, error) {
 	slog.Debug("Downloading link", slog.String("link", link))
+	fetchedAt := time.Now()
 	resp, err := http.Get(link)
 	if err != nil {
 		return nil, fmt.Errorf("download %s: %w", link, err)
@@ -18,14 +48,31 @@ func Download(link string) ([]byte, error) {
 	if resp.StatusCode == http.StatusTooManyRequests {
 		slog.Debug("Too many requests, retrying in 1 second")
 		time.Sleep(1 * time.Second)
-		return Download(link)
+		return FetchLimited(link, maxSize)
 	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("get %s: %s", link, resp.Status)
 	}
-	data, err := io.ReadAll(resp.Body)
+	body := io.Reader(resp.Body)
+	if maxSize >= 0 {
+		if resp.ContentLength > int64(maxSize) {
+			return nil, fmt.Errorf("get %s: %w", link, ErrTooLarge)
+		}
+		body = io.LimitReader(resp.Body, int64(maxSize)+1)
+	}
+	data, err := io.ReadAll(body)
 	if err != nil {
 		return nil, fmt.Errorf("read response from %s: %w", link, err)
 	}
-	return data, nil
+	if maxSize >= 0 && len(data) > maxSize {
+		return nil, fmt.Errorf("get %s: %w", link, ErrTooLarge)
+	}
+	return &Response{
+		URL:         link,
+		FinalURL:    resp.Request.URL.String(),
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		FetchedAt:   fetchedAt,
+		Data:        data,
+	}, nil
 }
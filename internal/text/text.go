@@ -0,0 +1,348 @@
+package text
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+const DefaultWidth = 80
+
+var (
+	blockTags = []string{
+		"address", "article", "aside", "body", "center", "details", "dialog", "dd", "div", "dl", "dt",
+		"fieldset", "figcaption", "figure", "footer", "form", "header", "hgroup", "html", "main", "nav",
+		"p", "section", "summary",
+	}
+	skippedTags = []string{
+		"audio", "button", "canvas", "head", "iframe", "input", "noscript", "object", "script", "select",
+		"style", "svg", "template", "textarea", "video",
+	}
+)
+
+type prefix struct {
+	first string
+	rest  string
+	used  bool
+}
+
+type renderer struct {
+	width     int
+	out       strings.Builder
+	inline    strings.Builder
+	prefixes  []*prefix
+	blank     bool
+	links     []string
+	linkIndex map[string]int
+}
+
+// Render writes the document as wrapped plain text. Block elements are
+// separated by blank lines, list items are bulleted, tables are aligned
+// in columns and links are listed as numbered references at the end.
+func Render(w io.Writer, root *html.Node, width int) error {
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	r := &renderer{width: width, linkIndex: make(map[string]int)}
+	if title, err := root.Find(html.IsTag("title")); err == nil {
+		if text := strings.Join(strings.Fields(title.Text()), " "); len(text) > 0 {
+			r.writeLine(text)
+			r.writeLine(strings.Repeat("=", min(utf8.RuneCountInString(text), width)))
+			r.blank = true
+		}
+	}
+	r.render(root)
+	r.flush()
+	if len(r.links) > 0 {
+		r.blank = true
+		for i, link := range r.links {
+			r.writeLine(fmt.Sprintf("[%d] %s", i+1, link))
+		}
+	}
+	if _, err := io.WriteString(w, r.out.String()); err != nil {
+		return fmt.Errorf("render text: %w", err)
+	}
+	return nil
+}
+
+func (r *renderer) render(node *html.Node) {
+	if node.IsText() {
+		r.writeInline(node.Text())
+		return
+	}
+	if !node.IsElement() {
+		r.renderChildren(node)
+		return
+	}
+	tag := node.Tag()
+	switch {
+	case slices.Contains(skippedTags, tag):
+	case tag == "br":
+		r.inline.WriteString("\n")
+	case tag == "hr":
+		r.block(func() {
+			r.writeLine(strings.Repeat("-", r.availableWidth()))
+		})
+	case tag == "img":
+		if alt, ok := node.GetAttr("alt"); ok && len(strings.TrimSpace(alt)) > 0 {
+			r.writeInline(fmt.Sprintf(" [%s] ", strings.TrimSpace(alt)))
+		}
+	case tag == "a":
+		r.renderChildren(node)
+		r.writeLinkRef(node)
+	case len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6':
+		r.block(func() {
+			r.writeInline(strings.Repeat("#", int(tag[1]-'0')) + " ")
+			r.renderChildren(node)
+		})
+	case tag == "pre":
+		r.block(func() {
+			for _, line := range strings.Split(strings.TrimSuffix(node.TextContent(), "\n"), "\n") {
+				r.writeLine(line)
+			}
+		})
+	case tag == "blockquote":
+		r.block(func() {
+			r.withPrefix("> ", "> ", func() {
+				r.renderChildren(node)
+			})
+		})
+	case tag == "ul" || tag == "ol":
+		r.renderList(node)
+	case tag == "table":
+		r.block(func() {
+			r.renderTable(node)
+		})
+	case slices.Contains(blockTags, tag):
+		r.block(func() {
+			r.renderChildren(node)
+		})
+	default:
+		r.renderChildren(node)
+	}
+}
+
+func (r *renderer) renderChildren(node *html.Node) {
+	for _, child := range node.Children() {
+		r.render(child)
+	}
+}
+
+func (r *renderer) renderList(list *html.Node) {
+	nested := len(r.prefixes) > 0
+	r.flush()
+	if !nested {
+		r.blank = true
+	}
+	n := 0
+	for _, item := range list.Children() {
+		if !item.IsElement() {
+			continue
+		}
+		if item.Tag() != "li" {
+			r.render(item)
+			continue
+		}
+		n++
+		bullet := "* "
+		if list.Tag() == "ol" {
+			bullet = fmt.Sprintf("%d. ", n)
+		}
+		r.withPrefix(bullet, strings.Repeat(" ", len(bullet)), func() {
+			r.renderChildren(item)
+			r.flush()
+		})
+	}
+	if !nested {
+		r.blank = true
+	}
+}
+
+func (r *renderer) renderTable(table *html.Node) {
+	var (
+		rows   [][]string
+		header bool
+		widths []int
+	)
+	for tr := range table.FindAll(html.IsTag("tr")) {
+		row := make([]string, 0)
+		for _, cell := range tr.Children() {
+			if !cell.IsElement() || (cell.Tag() != "td" && cell.Tag() != "th") {
+				continue
+			}
+			if len(rows) == 0 && cell.Tag() == "th" {
+				header = true
+			}
+			row = append(row, r.inlineText(cell))
+		}
+		for i, text := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(text))
+		}
+		rows = append(rows, row)
+	}
+	for i, row := range rows {
+		r.writeLine(formatRow(row, widths))
+		if i == 0 && header {
+			separator := make([]string, len(widths))
+			for j, w := range widths {
+				separator[j] = strings.Repeat("-", w)
+			}
+			r.writeLine(formatRow(separator, widths))
+		}
+	}
+}
+
+func formatRow(row []string, widths []int) string {
+	sb := strings.Builder{}
+	for i, text := range row {
+		if i > 0 {
+			sb.WriteString("  ")
+		}
+		sb.WriteString(text)
+		if i < len(row)-1 {
+			sb.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(text)))
+		}
+	}
+	return sb.String()
+}
+
+func (r *renderer) inlineText(node *html.Node) string {
+	saved := r.inline.String()
+	r.inline.Reset()
+	r.renderChildren(node)
+	text := strings.Join(strings.Fields(r.inline.String()), " ")
+	r.inline.Reset()
+	r.inline.WriteString(saved)
+	return text
+}
+
+func (r *renderer) writeLinkRef(node *html.Node) {
+	href, ok := node.GetAttr("href")
+	if !ok || len(href) == 0 || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
+		return
+	}
+	idx, ok := r.linkIndex[href]
+	if !ok {
+		r.links = append(r.links, href)
+		idx = len(r.links)
+		r.linkIndex[href] = idx
+	}
+	r.inline.WriteString(fmt.Sprintf("[%d]", idx))
+}
+
+func (r *renderer) writeInline(s string) {
+	if len(strings.TrimSpace(s)) == 0 {
+		if len(s) > 0 {
+			r.inline.WriteString(" ")
+		}
+		return
+	}
+	if isSpace(s[0]) {
+		r.inline.WriteString(" ")
+	}
+	r.inline.WriteString(strings.Join(strings.Fields(s), " "))
+	if isSpace(s[len(s)-1]) {
+		r.inline.WriteString(" ")
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func (r *renderer) block(fn func()) {
+	r.flush()
+	r.blank = true
+	fn()
+	r.flush()
+	r.blank = true
+}
+
+func (r *renderer) withPrefix(first, rest string, fn func()) {
+	r.flush()
+	r.prefixes = append(r.prefixes, &prefix{first: first, rest: rest})
+	fn()
+	r.flush()
+	r.prefixes = r.prefixes[:len(r.prefixes)-1]
+}
+
+func (r *renderer) flush() {
+	text := r.inline.String()
+	r.inline.Reset()
+	for _, line := range strings.Split(text, "\n") {
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		for _, wrapped := range wrap(words, r.availableWidth()) {
+			r.writeLine(wrapped)
+		}
+	}
+}
+
+func (r *renderer) availableWidth() int {
+	w := r.width
+	for _, p := range r.prefixes {
+		w -= utf8.RuneCountInString(p.rest)
+	}
+	return max(w, 1)
+}
+
+func (r *renderer) writeLine(line string) {
+	if r.blank && r.out.Len() > 0 {
+		r.out.WriteString(strings.TrimRight(r.restPrefix(), " "))
+		r.out.WriteString("\n")
+	}
+	r.blank = false
+	r.out.WriteString(strings.TrimRight(r.linePrefix()+line, " "))
+	r.out.WriteString("\n")
+}
+
+func (r *renderer) linePrefix() string {
+	sb := strings.Builder{}
+	for _, p := range r.prefixes {
+		if p.used {
+			sb.WriteString(p.rest)
+		} else {
+			sb.WriteString(p.first)
+		}
+		p.used = true
+	}
+	return sb.String()
+}
+
+func (r *renderer) restPrefix() string {
+	sb := strings.Builder{}
+	for _, p := range r.prefixes {
+		if p.used {
+			sb.WriteString(p.rest)
+		}
+	}
+	return sb.String()
+}
+
+func wrap(words []string, width int) []string {
+	lines := make([]string, 0)
+	line := strings.Builder{}
+	for _, word := range words {
+		if line.Len() > 0 && utf8.RuneCountInString(line.String())+1+utf8.RuneCountInString(word) > width {
+			lines = append(lines, line.String())
+			line.Reset()
+		}
+		if line.Len() > 0 {
+			line.WriteString(" ")
+		}
+		line.WriteString(word)
+	}
+	if line.Len() > 0 {
+		lines = append(lines, line.String())
+	}
+	return lines
+}
@@ -0,0 +1,71 @@
+package text_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/text"
+)
+
+func TestRender(t *testing.T) {
+	bee := bee.New(t)
+	s := `<html><head><title>Doc</title><style>p { color: red; }</style></head><body>
+<h1>Heading</h1>
+<p>Some   <b>bold</b> text with a <a href="https://example.com/a">link</a> and the same <a href="https://example.com/a">link</a> again.</p>
+<script>alert(1)</script>
+<ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul>
+<blockquote>quoted text</blockquote>
+<table><tr><th>Name</th><th>Value</th></tr><tr><td>a</td><td>1</td></tr><tr><td>longer</td><td>22</td></tr></table>
+<pre>line 1
+  line 2</pre>
+</body></html>`
+	expected := `Doc
+===
+
+# Heading
+
+Some bold text with a link[1] and the same link[1] again.
+
+* one
+* two
+  1. nested
+
+> quoted text
+
+Name    Value
+------  -----
+a       1
+longer  22
+
+line 1
+  line 2
+
+[1] https://example.com/a
+`
+	root, err := html.Parse(strings.NewReader(s))
+	bee.Nil(err)
+	sb := &strings.Builder{}
+	err = text.Render(sb, root, 80)
+	bee.Nil(err)
+	bee.Equal(sb.String(), expected)
+}
+
+func TestRenderWrap(t *testing.T) {
+	bee := bee.New(t)
+	s := `<p>the quick brown fox jumps over the lazy dog</p><ul><li>the quick brown fox jumps</li></ul>`
+	expected := `the quick brown
+fox jumps over the
+lazy dog
+
+* the quick brown
+  fox jumps
+`
+	root, err := html.Parse(strings.NewReader(s))
+	bee.Nil(err)
+	sb := &strings.Builder{}
+	err = text.Render(sb, root, 18)
+	bee.Nil(err)
+	bee.Equal(sb.String(), expected)
+}
@@ -0,0 +1,83 @@
+package transform
+
+import (
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+// svgURLAttrs are the SVG presentation attributes which may reference
+// paint servers, clip paths, masks, filters and markers with url().
+var svgURLAttrs = []string{
+	"fill",
+	"stroke",
+	"clip-path",
+	"mask",
+	"filter",
+	"marker-start",
+	"marker-mid",
+	"marker-end",
+}
+
+// backgroundTags are the elements the legacy background attribute applies
+// to.
+var backgroundTags = []string{"body", "table", "thead", "tbody", "tfoot", "tr", "td", "th"}
+
+// InlineStyleAttributes inlines the url() references of style attributes and
+// SVG presentation attributes, and the images of legacy background
+// attributes. References to fragments of the document itself are kept.
+// The image-set() candidates of style attributes are selected like in
+// stylesheets.
+func InlineStyleAttributes(baseURL *url.URL, opts StyleOptions) Transformer {
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		docURL := documentBaseURL(node, baseURL)
+		for _, name := range append([]string{"style"}, svgURLAttrs...) {
+			nodes := slices.Collect(node.FindAll(html.HasAttrFunc(name, hasURL)))
+			for _, n := range nodes {
+				value, _ := n.GetAttr(name)
+				slog.Debug("Inline attribute URLs", slog.String("tag", n.Tag()), slog.String("attr", name))
+				var err error
+				if name == "style" {
+					if value, err = selectSources(ctx, docURL, value, opts); err != nil {
+						return err
+					}
+				}
+				value, err = inlineLinks(ctx, docURL, value)
+				if err != nil {
+					return err
+				}
+				n.DeleteAttr(name)
+				n.SetAttr(name, value)
+			}
+		}
+		nodes := slices.Collect(node.FindAll(
+			html.NodeFilterFunc(func(n *html.Node) bool { return slices.Contains(backgroundTags, n.Tag()) }),
+			html.HasAttrFunc("background", func(v string) bool {
+				v = strings.TrimSpace(v)
+				return len(v) > 0 && !strings.HasPrefix(v, "data:")
+			}),
+		))
+		for _, n := range nodes {
+			background, _ := n.GetAttr("background")
+			link, err := resolveRef(docURL, strings.TrimSpace(background))
+			if err != nil {
+				return err
+			}
+			slog.Debug("Inline background", slog.String("src", link))
+			src, err := downloadAndBase64Encode(ctx, link)
+			if err != nil {
+				return err
+			}
+			n.DeleteAttr("background")
+			n.SetAttr("background", src)
+		}
+		return nil
+	})
+}
+
+func hasURL(value string) bool {
+	return strings.Contains(strings.ToLower(value), "url(")
+}
@@ -0,0 +1,80 @@
+package transform
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+// placeholderImage is the transparent 1x1 GIF image the deduplicated img
+// elements keep as their source, their content is set by a style rule.
+const placeholderImage = "data:image/gif;base64,R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7"
+
+// dedupeClassPrefix is the prefix of the classes of the deduplicated images.
+const dedupeClassPrefix = "htdl-img-"
+
+// DeduplicateImages embeds the data URLs repeated in the src attributes of
+// img elements once, in content rules of a style element setting the
+// images by class. The content of an img element replaces its source, so
+// the images render with their own size as before. Images which are part
+// of a srcset or a picture element are kept, as the browser selects their
+// source, and so are the data URLs whose rule would not be shorter than
+// their copies.
+func DeduplicateImages() Transformer {
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		head, err := node.Find(html.IsTag("head"))
+		if err != nil {
+			return nil
+		}
+		srcs := make([]string, 0)
+		imgs := make(map[string][]*html.Node)
+		for n := range node.FindAll(html.IsTag("img"), html.HasAttrFunc("src", func(v string) bool {
+			return strings.HasPrefix(v, "data:")
+		})) {
+			if _, ok := n.GetAttr("srcset"); ok {
+				continue
+			}
+			if parent := n.Parent(); parent != nil && parent.Tag() == "picture" {
+				continue
+			}
+			src, _ := n.GetAttr("src")
+			if _, ok := imgs[src]; !ok {
+				srcs = append(srcs, src)
+			}
+			imgs[src] = append(imgs[src], n)
+		}
+		rules := make([]string, 0)
+		saved := 0
+		for _, src := range srcs {
+			nodes := imgs[src]
+			if len(nodes) < 2 {
+				continue
+			}
+			class := fmt.Sprintf("%s%d", dedupeClassPrefix, len(rules)+1)
+			rule := fmt.Sprintf("img.%s { content: url(\"%s\") }", class, src)
+			saving := len(nodes)*(len(src)-len(placeholderImage)-len(class)-1) - len(rule)
+			if saving <= 0 {
+				continue
+			}
+			slog.Debug("Deduplicate image", slog.Int("count", len(nodes)), slog.Int("size", len(src)))
+			for _, n := range nodes {
+				if classes, ok := n.GetAttr("class"); ok {
+					n.ReplaceAttr("class", strings.TrimSpace(classes+" "+class))
+				} else {
+					n.SetAttr("class", class)
+				}
+				n.ReplaceAttr("src", placeholderImage)
+			}
+			rules = append(rules, rule)
+			saved += saving
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		head.AppendChild(html.NewNode("style", nil, strings.Join(rules, "\n")))
+		ctx.save(saved)
+		return nil
+	})
+}
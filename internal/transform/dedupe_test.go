@@ -0,0 +1,58 @@
+package transform_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestDeduplicateImages(t *testing.T) {
+	bee := bee.New(t)
+	logo := strings.Repeat("logo", 50)
+	files := map[string]string{
+		"/index.html": `<html><head></head><body><img src="logo.png"><img src="logo.png" class="small">` +
+			`<img src="copy.png"><img src="dot.png"><img src="dot.png"></body></html>`,
+		"/logo.png": logo,
+		"/copy.png": logo,
+		"/dot.png":  "dot",
+	}
+	fetched := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched[r.URL.Path]++
+		_, _ = w.Write([]byte(files[r.URL.Path]))
+	}))
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{
+			transform.ResolveLinks(baseURL),
+			transform.InlineImages(transform.ImageOptions{}),
+			transform.DeduplicateImages(),
+		}
+	})
+	placeholder := "data:image/gif;base64,R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7"
+	dot := imageDataURL("png", "dot")
+	expected := `<html><head><style>img.htdl-img-1 { content: url("` + imageDataURL("png", logo) + `") }</style></head><body>` +
+		`<img src="` + placeholder + `" class="htdl-img-1"/><img class="small htdl-img-1" src="` + placeholder + `"/>` +
+		`<img src="` + placeholder + `" class="htdl-img-1"/><img src="` + dot + `"/><img src="` + dot + `"/></body></html>`
+	bee.Equal(root.RenderString(), expected)
+	bee.Equal(fetched["/logo.png"], 1)
+	bee.Equal(fetched["/dot.png"], 1)
+}
+
+func TestDeduplicateImagesKeepsSelectedSources(t *testing.T) {
+	bee := bee.New(t)
+	src := imageDataURL("png", strings.Repeat("logo", 50))
+	root, err := html.Parse(strings.NewReader(`<html><head></head><body>` +
+		`<picture><img src="` + src + `"></picture><img src="` + src + `" srcset="` + src + ` 1x"></body></html>`))
+	bee.Nil(err)
+	before := root.RenderString()
+	err = transform.NewPipeline(transform.DeduplicateImages()).Run(root)
+	bee.Nil(err)
+	bee.Equal(root.RenderString(), before)
+}
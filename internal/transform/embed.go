@@ -0,0 +1,230 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+// embedClass is the class of the cards replacing the embeds.
+const embedClass = "htdl-embed"
+
+// embedCardStyle makes the cards look alike without the styles of the page.
+const embedCardStyle = "display: inline-block; max-width: 100%; margin: 0; padding: 8px; " +
+	"border: 1px solid #ccc; box-sizing: border-box"
+
+// EmbedRule describes the iframes of a third-party embed and the card
+// replacing them.
+type EmbedRule struct {
+	// Hosts are the hosts of the iframe sources the rule applies to,
+	// including their subdomains.
+	Hosts []string `json:"hosts"`
+	// Pattern is the regular expression the source URL must match. Its
+	// groups can be referred to in Link and Thumbnail as $1 or ${name}. An
+	// empty pattern matches every source of the hosts.
+	Pattern string `json:"pattern,omitempty"`
+	// Title is the title of the card if the iframe has no title.
+	Title string `json:"title"`
+	// Link is the template of the link to the original, it defaults to the
+	// source URL.
+	Link string `json:"link,omitempty"`
+	// LinkParam is the query parameter of the source holding the link to
+	// the original, used if Link is empty.
+	LinkParam string `json:"linkParam,omitempty"`
+	// Thumbnail is the template of the URL of the thumbnail, the card has no
+	// thumbnail if it is empty.
+	Thumbnail string `json:"thumbnail,omitempty"`
+}
+
+// DefaultEmbedRules are the rules of the common video, map and social post
+// embeds. Thumbnails are only set where the URL of the embed is enough to
+// derive them.
+var DefaultEmbedRules = []EmbedRule{
+	{
+		Hosts:     []string{"youtube.com", "youtube-nocookie.com"},
+		Pattern:   `/embed/([\w-]+)`,
+		Title:     "YouTube video",
+		Link:      "https://www.youtube.com/watch?v=$1",
+		Thumbnail: "https://i.ytimg.com/vi/$1/hqdefault.jpg",
+	},
+	{
+		Hosts:   []string{"player.vimeo.com"},
+		Pattern: `/video/(\d+)`,
+		Title:   "Vimeo video",
+		Link:    "https://vimeo.com/$1",
+	},
+	{
+		Hosts:     []string{"dailymotion.com"},
+		Pattern:   `/embed/video/(\w+)`,
+		Title:     "Dailymotion video",
+		Link:      "https://www.dailymotion.com/video/$1",
+		Thumbnail: "https://www.dailymotion.com/thumbnail/video/$1",
+	},
+	{
+		Hosts:   []string{"google.com"},
+		Pattern: `/maps/embed`,
+		Title:   "Google Maps",
+	},
+	{
+		Hosts:   []string{"platform.twitter.com"},
+		Pattern: `[?&]id=(\d+)`,
+		Title:   "Post on X",
+		Link:    "https://x.com/i/status/$1",
+	},
+	{
+		Hosts:     []string{"instagram.com"},
+		Pattern:   `/(p|reel)/([\w-]+)`,
+		Title:     "Instagram post",
+		Link:      "https://www.instagram.com/$1/$2/",
+		Thumbnail: "https://www.instagram.com/$1/$2/media/?size=l",
+	},
+	{
+		Hosts:     []string{"facebook.com"},
+		Pattern:   `/plugins/(post|video)\.php`,
+		Title:     "Facebook post",
+		LinkParam: "href",
+	},
+}
+
+// ParseEmbedRules parses the JSON array of embed rules of a config file.
+func ParseEmbedRules(data []byte) ([]EmbedRule, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	rules := make([]EmbedRule, 0)
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("parse embed rules: %w", err)
+	}
+	for i, rule := range rules {
+		if len(rule.Hosts) == 0 {
+			return nil, fmt.Errorf("embed rule %d has no hosts", i+1)
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return nil, fmt.Errorf("embed rule %d: %w", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// matches reports whether the rule applies to the source, and returns the
+// indices of the groups of its pattern.
+func (r EmbedRule) matches(src *url.URL, pattern *regexp.Regexp) ([]int, bool) {
+	host := strings.ToLower(src.Hostname())
+	matchesHost := slices.ContainsFunc(r.Hosts, func(h string) bool {
+		h = strings.ToLower(h)
+		return host == h || strings.HasSuffix(host, "."+h)
+	})
+	if !matchesHost {
+		return nil, false
+	}
+	match := pattern.FindStringSubmatchIndex(src.String())
+	return match, match != nil
+}
+
+// ReplaceEmbeds replaces the iframes matching the first applicable rule with
+// a static card showing the thumbnail, the title and a link to the
+// original, since embeds never work offline. Thumbnails are inlined and
+// optimized like the img elements, cards of thumbnails which fail to load
+// only show the title.
+func ReplaceEmbeds(baseURL *url.URL, rules []EmbedRule, opts ImageOptions) Transformer {
+	opts = opts.withDefaults()
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		patterns := make([]*regexp.Regexp, len(rules))
+		for i, rule := range rules {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return fmt.Errorf("compile embed pattern %s: %w", rule.Pattern, err)
+			}
+			patterns[i] = pattern
+		}
+		docURL := documentBaseURL(node, baseURL)
+		iframes := slices.Collect(node.FindAll(html.IsTag("iframe"), html.HasAttrFunc("src", isNetworkRef)))
+		for _, n := range iframes {
+			v, _ := n.GetAttr("src")
+			link, err := resolveRef(docURL, strings.TrimSpace(v))
+			if err != nil {
+				return err
+			}
+			src, err := url.Parse(link)
+			if err != nil {
+				return fmt.Errorf("parse URL from %s: %w", link, err)
+			}
+			for i, rule := range rules {
+				if match, ok := rule.matches(src, patterns[i]); ok {
+					replaceEmbed(n, ctx, rule, src, patterns[i], match, opts)
+					break
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func replaceEmbed(node *html.Node, ctx *TransformerContext, rule EmbedRule, src *url.URL, pattern *regexp.Regexp, match []int, opts ImageOptions) {
+	link := src.String()
+	if len(rule.Link) > 0 {
+		link = string(pattern.ExpandString(nil, rule.Link, src.String(), match))
+	} else if original := src.Query().Get(rule.LinkParam); len(rule.LinkParam) > 0 && len(original) > 0 {
+		link = original
+	}
+	title := rule.Title
+	if t, ok := node.GetAttr("title"); ok && len(strings.TrimSpace(t)) > 0 {
+		title = strings.TrimSpace(t)
+	}
+	style := embedCardStyle
+	w, _ := node.GetAttr("width")
+	if width, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(w), "px")); err == nil && width > 0 {
+		style = fmt.Sprintf("%s; width: %dpx", style, width)
+	}
+	attrs := map[string]string{"class": embedClass, "style": style}
+	if id, ok := node.GetAttr("id"); ok {
+		attrs["id"] = id
+	}
+	card := html.NewNode("figure", attrs, "")
+	if len(rule.Thumbnail) > 0 {
+		thumbnail := string(pattern.ExpandString(nil, rule.Thumbnail, src.String(), match))
+		if data, ok := embedThumbnail(ctx, thumbnail, opts); ok {
+			a := html.NewNode("a", map[string]string{"href": link}, "")
+			a.AppendChild(html.NewNode("img", map[string]string{"src": data, "alt": title, "style": "display: block; width: 100%"}, ""))
+			card.AppendChild(a)
+		}
+	}
+	caption := html.NewNode("figcaption", nil, "")
+	caption.AppendChild(html.NewNode("a", map[string]string{"href": link}, title))
+	card.AppendChild(caption)
+	slog.Debug("Replace embed", slog.String("src", src.String()), slog.String("link", link))
+	ctx.skip(src.String(), "replaced with a static card")
+	node.ReplaceWith(card)
+}
+
+// embedThumbnail returns the data URL of the thumbnail, or false if it
+// cannot be loaded.
+func embedThumbnail(ctx *TransformerContext, link string, opts ImageOptions) (string, bool) {
+	resp, err := ctx.fetch(link)
+	if err != nil {
+		slog.Debug("Skip thumbnail", slog.String("src", link), slog.String("error", err.Error()))
+		return "", false
+	}
+	mimeType, err := fetchedImageMIMEType(link, resp.ContentType)
+	if err != nil {
+		slog.Debug("Skip thumbnail", slog.String("src", link), slog.String("error", err.Error()))
+		return "", false
+	}
+	data, err := ctx.download(link, mimeType)
+	if err != nil {
+		slog.Debug("Skip thumbnail", slog.String("src", link), slog.String("error", err.Error()))
+		return "", false
+	}
+	optimized, optimizedType := optimizeImage(data, mimeType, opts)
+	if saved := len(data) - len(optimized); saved > 0 {
+		ctx.save(saved)
+	}
+	return dataURL(optimizedType, optimized), true
+}
@@ -0,0 +1,60 @@
+package transform_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestReplaceEmbeds(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body>` +
+			`<iframe id="clip" src="/embed/abc" width="560" height="315" title="Talk"></iframe>` +
+			`<iframe src="/embed/missing"></iframe>` +
+			`<iframe src="https://player.vimeo.com/video/42?h=1"></iframe>` +
+			`<iframe src="/other"></iframe></body></html>`,
+		"/thumbnails/abc.png": "thumbnail",
+	})
+	defer srv.Close()
+	rules, err := transform.ParseEmbedRules([]byte(`[{
+		"hosts": ["127.0.0.1"],
+		"pattern": "/embed/(?P<id>\\w+)",
+		"title": "Video",
+		"link": "https://video.example.org/w/${id}",
+		"thumbnail": "` + srv.URL + `/thumbnails/$1.png"
+	}]`))
+	bee.Nil(err)
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{
+			transform.ReplaceEmbeds(baseURL, append(rules, transform.DefaultEmbedRules...), transform.ImageOptions{}),
+		}
+	})
+	body, err := root.Find(html.IsTag("body"))
+	bee.Nil(err)
+	style := `display: inline-block; max-width: 100%; margin: 0; padding: 8px; border: 1px solid #ccc; box-sizing: border-box`
+	expected := `<body>` +
+		`<figure class="htdl-embed" id="clip" style="` + style + `; width: 560px">` +
+		`<a href="https://video.example.org/w/abc"><img alt="Talk" src="` + imageDataURL("png", "thumbnail") + `" style="display: block; width: 100%"/></a>` +
+		`<figcaption><a href="https://video.example.org/w/abc">Talk</a></figcaption></figure>` +
+		`<figure class="htdl-embed" style="` + style + `"><figcaption><a href="https://video.example.org/w/missing">Video</a></figcaption></figure>` +
+		`<figure class="htdl-embed" style="` + style + `"><figcaption><a href="https://vimeo.com/42">Vimeo video</a></figcaption></figure>` +
+		`<iframe src="/other"></iframe></body>`
+	bee.Equal(body.RenderString(), expected)
+}
+
+func TestParseEmbedRulesInvalid(t *testing.T) {
+	bee := bee.New(t)
+	for _, data := range []string{
+		`{"hosts": ["example.org"]}`,
+		`[{"title": "Video"}]`,
+		`[{"hosts": ["example.org"], "pattern": "("}]`,
+		`[{"hosts": ["example.org"], "thumbnails": "x"}]`,
+	} {
+		_, err := transform.ParseEmbedRules([]byte(data))
+		bee.NotNil(err)
+	}
+}
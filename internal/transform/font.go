@@ -0,0 +1,801 @@
+package transform
+
+import (
+	"cmp"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/danielrenes/htdl/internal/css"
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+// maxVarDepth limits the nesting of var() references, which also stops
+// reference cycles.
+const maxVarDepth = 16
+
+// fontStyleOrder is the order in which face styles are tried for a
+// requested style by the font matching algorithm.
+var fontStyleOrder = map[string][]string{
+	"normal":  {"normal", "oblique", "italic"},
+	"italic":  {"italic", "oblique", "normal"},
+	"oblique": {"oblique", "italic", "normal"},
+}
+
+var systemFonts = []string{"caption", "icon", "menu", "message-box", "small-caption", "status-bar"}
+
+var fontSizeKeywords = []string{
+	"xx-small", "x-small", "small", "medium", "large", "x-large", "xx-large", "xxx-large", "larger", "smaller", "math",
+}
+
+var formControls = []string{"input", "textarea", "select", "button"}
+
+// defaultFontStyles are the font declarations of the default stylesheet of
+// browsers, which apply below the presentational attributes and the rules
+// of the document.
+var defaultFontStyles = map[string]string{
+	"address": "font-style: italic",
+	"cite":    "font-style: italic",
+	"dfn":     "font-style: italic",
+	"em":      "font-style: italic",
+	"i":       "font-style: italic",
+	"var":     "font-style: italic",
+	"b":       "font-weight: bolder",
+	"strong":  "font-weight: bolder",
+	"h1":      "font-weight: bold",
+	"h2":      "font-weight: bold",
+	"h3":      "font-weight: bold",
+	"h4":      "font-weight: bold",
+	"h5":      "font-weight: bold",
+	"h6":      "font-weight: bold",
+	"th":      "font-weight: bold",
+}
+
+// fontStyle is the approximated computed font of an element. A zero weight
+// or an empty style means the value is unknown.
+type fontStyle struct {
+	families []string
+	weight   float64
+	style    string
+	vars     map[string][]css.Token
+}
+
+// fontUsage is a font an element renders text with. Nil runes mean the
+// text is unknown.
+type fontUsage struct {
+	family string
+	weight float64
+	style  string
+	runes  map[rune]bool
+}
+
+// fontKey identifies a used font regardless of the text.
+type fontKey struct {
+	family string
+	weight float64
+	style  string
+}
+
+type fontFace struct {
+	family string
+	style  string
+	weight [2]float64
+	ranges [][2]rune
+	used   bool
+}
+
+type styleRule struct {
+	selectors    css.SelectorList
+	declarations []*css.Declaration
+	order        int
+}
+
+type ruleMatch struct {
+	rule        *styleRule
+	specificity [3]int
+	pseudo      string
+}
+
+type cascadeEntry struct {
+	declaration *css.Declaration
+	level       int
+	specificity [3]int
+	order       int
+}
+
+type fontPruner struct {
+	rules []*styleRule
+	// faces maps the family names to their @font-face rules, keyed by the
+	// source of the rule.
+	faces map[string]map[string]*fontFace
+	// keep holds the families referenced by rules which cannot be
+	// evaluated, all faces of which are kept.
+	keep   map[string]bool
+	usages map[fontKey]map[rune]bool
+}
+
+// PruneFonts removes the @font-face rules no text of the document can be
+// rendered with. It approximates the cascade of font-family, font-weight,
+// font-style and the font shorthand over the elements and pseudo-elements
+// with text, starting from the default styles of browsers and ignoring
+// media conditions, and then runs the font matching
+// algorithm of CSS Fonts with the unicode ranges of the faces. Styles of
+// rules which only apply on interaction, like :hover, are added to the
+// used fonts of the elements they match.
+func PruneFonts() Transformer {
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		p := &fontPruner{
+			faces: make(map[string]map[string]*fontFace),
+			keep:  make(map[string]bool),
+		}
+		styleNodes := slices.Collect(node.FindAll(html.IsTag("style")))
+		sheets := make([]*css.Stylesheet, len(styleNodes))
+		for i, n := range styleNodes {
+			sheets[i] = css.Parse(n.Text())
+			p.collectRules(sheets[i].Rules)
+		}
+		if len(p.faces) == 0 {
+			return nil
+		}
+		p.usages = make(map[fontKey]map[rune]bool)
+		p.walk(node, &fontStyle{weight: 400, style: "normal"})
+		p.match()
+		removed, saved := 0, 0
+		for i, n := range styleNodes {
+			sheets[i].Rules = pruneRules(sheets[i].Rules, func(rule *css.Rule) bool {
+				if face := p.face(rule); face != nil && !face.used {
+					removed++
+					return false
+				}
+				return true
+			})
+			before := len(n.Text())
+			n.SetText(sheets[i].String())
+			saved += before - len(n.Text())
+		}
+		if removed > 0 {
+			slog.Info("Remove unused fonts", slog.Int("faces", removed), slog.Int("bytes", saved))
+		}
+		ctx.save(saved)
+		return nil
+	})
+}
+
+func (p *fontPruner) collectRules(rules []*css.Rule) {
+	for _, rule := range rules {
+		switch {
+		case !rule.HasBlock:
+		case rule.Is("font-face"):
+			face := newFontFace(rule.Block)
+			if len(face.family) == 0 {
+				continue
+			}
+			if p.faces[face.family] == nil {
+				p.faces[face.family] = make(map[string]*fontFace)
+			}
+			p.faces[face.family][css.Serialize(rule.Block)] = face
+		case slices.ContainsFunc(groupRules, rule.Is):
+			p.collectRules(css.ParseRules(rule.Block).Rules)
+		case len(rule.AtKeyword) == 0:
+			selectors, err := css.ParseSelectors(rule.Prelude)
+			nested := slices.ContainsFunc(rule.Block, func(t css.Token) bool { return t.Type == css.LeftBrace })
+			if err != nil || nested {
+				collectFonts(rule.Block, p.keep)
+				continue
+			}
+			declarations := slices.DeleteFunc(css.ParseDeclarations(rule.Block), func(d *css.Declaration) bool {
+				return !isFontProperty(d)
+			})
+			if len(declarations) > 0 {
+				p.rules = append(p.rules, &styleRule{selectors: selectors, declarations: declarations, order: len(p.rules)})
+			}
+		}
+	}
+}
+
+func (p *fontPruner) face(rule *css.Rule) *fontFace {
+	if !rule.Is("font-face") {
+		return nil
+	}
+	face := newFontFace(rule.Block)
+	return p.faces[face.family][css.Serialize(rule.Block)]
+}
+
+func isFontProperty(d *css.Declaration) bool {
+	return strings.HasPrefix(d.Name, "--") || d.Is("font") || d.Is("font-family") ||
+		d.Is("font-weight") || d.Is("font-style") || d.Is("content")
+}
+
+// walk computes the fonts of the element and its descendants and returns
+// the fonts they use.
+func (p *fontPruner) walk(node *html.Node, parent *fontStyle) []fontUsage {
+	if !node.IsElement() {
+		usages := make([]fontUsage, 0)
+		for _, child := range node.Children() {
+			usages = append(usages, p.walk(child, parent)...)
+		}
+		return usages
+	}
+	if slices.Contains([]string{"head", "script", "style", "template"}, node.Tag()) {
+		return nil
+	}
+	static := p.matches(node, css.MatchOptions{})
+	own := make([]ruleMatch, 0, len(static))
+	pseudos := make(map[string][]ruleMatch)
+	for _, m := range static {
+		if len(m.pseudo) > 0 {
+			pseudos[m.pseudo] = append(pseudos[m.pseudo], m)
+		} else {
+			own = append(own, m)
+		}
+	}
+	computed := p.cascade(parent, own, node)
+	usages := make([]fontUsage, 0)
+	runes := textRunes(node)
+	if len(runes) > 0 {
+		usages = append(usages, p.use(computed, runes)...)
+	}
+	if slices.Contains(formControls, node.Tag()) {
+		usages = append(usages, p.use(computed, nil)...)
+	}
+	for pseudo, matches := range pseudos {
+		style := p.cascade(computed, matches, nil)
+		pseudoRunes := runes
+		if pseudo == "before" || pseudo == "after" {
+			var ok bool
+			if pseudoRunes, ok = contentRunes(matches); !ok {
+				continue
+			}
+		} else if len(pseudoRunes) == 0 {
+			pseudoRunes = nil
+		}
+		usages = append(usages, p.use(style, pseudoRunes)...)
+	}
+	for _, child := range node.Children() {
+		usages = append(usages, p.walk(child, computed)...)
+	}
+	// The usages are merged first, so the state rules of the ancestors do
+	// not multiply the usages of deeply nested elements.
+	usages = mergeUsages(usages)
+	for _, m := range p.matches(node, css.MatchOptions{AssumeState: true}) {
+		if len(m.pseudo) > 0 || slices.ContainsFunc(static, func(s ruleMatch) bool { return s.rule == m.rule }) {
+			continue
+		}
+		for _, u := range slices.Clone(usages) {
+			base := &fontStyle{families: []string{u.family}, weight: u.weight, style: u.style, vars: computed.vars}
+			usages = append(usages, p.use(p.cascade(base, []ruleMatch{m}, nil), u.runes)...)
+		}
+		usages = mergeUsages(usages)
+	}
+	return usages
+}
+
+// mergeUsages merges the usages of the same font into one with the union
+// of their runes, keeping the order of the first usages.
+func mergeUsages(usages []fontUsage) []fontUsage {
+	merged := make([]fontUsage, 0, len(usages))
+	index := make(map[fontKey]int)
+	for _, u := range usages {
+		key := fontKey{family: u.family, weight: u.weight, style: u.style}
+		i, ok := index[key]
+		switch {
+		case !ok:
+			index[key] = len(merged)
+			merged = append(merged, fontUsage{family: u.family, weight: u.weight, style: u.style, runes: maps.Clone(u.runes)})
+		case merged[i].runes != nil && u.runes != nil:
+			maps.Copy(merged[i].runes, u.runes)
+		case u.runes == nil:
+			merged[i].runes = nil
+		}
+	}
+	return merged
+}
+
+// matches returns the rules matching the element, with the specificity of
+// the most specific matching selector per pseudo-element.
+func (p *fontPruner) matches(node *html.Node, opts css.MatchOptions) []ruleMatch {
+	matches := make([]ruleMatch, 0)
+	for _, rule := range p.rules {
+		best := make(map[string][3]int)
+		for _, selector := range rule.selectors {
+			if !selector.Matches(node, opts) {
+				continue
+			}
+			pseudo := selector.PseudoElement()
+			specificity, ok := best[pseudo]
+			if other := selector.Specificity(); !ok || slices.Compare(other[:], specificity[:]) > 0 {
+				best[pseudo] = other
+			}
+		}
+		for _, pseudo := range slices.Sorted(maps.Keys(best)) {
+			matches = append(matches, ruleMatch{rule: rule, specificity: best[pseudo], pseudo: pseudo})
+		}
+	}
+	return matches
+}
+
+// cascade applies the declarations of the matching rules, and of the
+// default styles, the style and the presentational attributes of the
+// element if it is not nil, in cascade order to the inherited font.
+func (p *fontPruner) cascade(parent *fontStyle, matches []ruleMatch, node *html.Node) *fontStyle {
+	entries := make([]cascadeEntry, 0)
+	for _, m := range matches {
+		for _, d := range m.rule.declarations {
+			entries = append(entries, cascadeEntry{declaration: d, level: 1, specificity: m.specificity, order: m.rule.order})
+		}
+	}
+	if node != nil {
+		if style, ok := defaultFontStyles[node.Tag()]; ok {
+			for i, d := range css.ParseDeclarations(css.Tokenize(style)) {
+				entries = append(entries, cascadeEntry{declaration: d, level: -1, order: i})
+			}
+		}
+		for _, name := range []string{"font-family", "face"} {
+			if family, ok := node.GetAttr(name); ok {
+				d := &css.Declaration{Name: "font-family", Value: css.Tokenize(family)}
+				entries = append(entries, cascadeEntry{declaration: d, level: 0})
+			}
+		}
+		if style, ok := node.GetAttr("style"); ok {
+			for i, d := range css.ParseDeclarations(css.Tokenize(style)) {
+				if isFontProperty(d) {
+					entries = append(entries, cascadeEntry{declaration: d, level: 2, order: i})
+				}
+			}
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b cascadeEntry) int {
+		if a.declaration.Important != b.declaration.Important {
+			if a.declaration.Important {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Or(
+			cmp.Compare(a.level, b.level),
+			slices.Compare(a.specificity[:], b.specificity[:]),
+			cmp.Compare(a.order, b.order),
+		)
+	})
+	computed := &fontStyle{families: parent.families, weight: parent.weight, style: parent.style, vars: parent.vars}
+	cloned := false
+	for _, e := range entries {
+		if strings.HasPrefix(e.declaration.Name, "--") {
+			if !cloned {
+				computed.vars = maps.Clone(parent.vars)
+				if computed.vars == nil {
+					computed.vars = make(map[string][]css.Token)
+				}
+				cloned = true
+			}
+			computed.vars[e.declaration.Name] = e.declaration.Value
+		}
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.declaration.Name, "--") {
+			computed.apply(e.declaration, parent)
+		}
+	}
+	return computed
+}
+
+func (f *fontStyle) apply(d *css.Declaration, parent *fontStyle) {
+	value, ok := substituteVars(d.Value, f.vars, 0)
+	value = css.Trim(value)
+	keyword := ""
+	if len(value) == 1 && value[0].Type == css.Ident {
+		keyword = strings.ToLower(value[0].Value)
+	}
+	inherit := !ok || slices.Contains([]string{"inherit", "unset", "revert", "revert-layer"}, keyword)
+	initial := keyword == "initial"
+	switch {
+	case d.Is("font-family"):
+		switch {
+		case inherit:
+			f.families = parent.families
+		case initial:
+			f.families = nil
+		default:
+			f.families = parseFamilies(value)
+		}
+	case d.Is("font-weight"):
+		switch {
+		case inherit:
+			f.weight = parent.weight
+		case initial:
+			f.weight = 400
+		default:
+			f.weight = parseWeight(value, parent.weight)
+		}
+	case d.Is("font-style"):
+		switch {
+		case inherit:
+			f.style = parent.style
+		case initial:
+			f.style = "normal"
+		default:
+			f.style = parseStyle(value)
+		}
+	case d.Is("font"):
+		switch {
+		case inherit:
+			f.families, f.weight, f.style = parent.families, parent.weight, parent.style
+		case initial, slices.Contains(systemFonts, keyword):
+			f.families, f.weight, f.style = nil, 400, "normal"
+		default:
+			f.applyShorthand(value, parent)
+		}
+	}
+}
+
+// applyShorthand applies the font shorthand, which resets the weight and
+// the style to normal unless it sets them. Invalid values are ignored.
+func (f *fontStyle) applyShorthand(value []css.Token, parent *fontStyle) {
+	weight, style := 400.0, "normal"
+	for i := 0; i < len(value); i++ {
+		token := value[i]
+		switch {
+		case token.Type == css.Whitespace || token.Type == css.Comment:
+		case token.Is(css.Ident, "italic") || token.Is(css.Ident, "oblique"):
+			style = strings.ToLower(token.Value)
+		case token.Type == css.Dimension && slices.Contains([]string{"deg", "grad", "rad", "turn"}, strings.ToLower(token.Unit)):
+		case token.Type == css.Ident && slices.Contains(fontSizeKeywords, strings.ToLower(token.Value)),
+			token.Type == css.Dimension, token.Type == css.Percentage, token.Type == css.Function,
+			token.Type == css.Number && token.Number == 0:
+			if token.Type == css.Function {
+				_, i = functionArgs(value, i)
+			}
+			rest := css.Trim(value[min(i+1, len(value)):])
+			if len(rest) > 0 && rest[0].Is(css.Delim, "/") {
+				rest = css.Trim(rest[1:])
+				if len(rest) > 0 && rest[0].Type == css.Function {
+					_, end := functionArgs(rest, 0)
+					rest = rest[min(end, len(rest)-1):]
+				}
+				rest = css.Trim(rest[1:])
+			}
+			if len(rest) == 0 {
+				return
+			}
+			f.families, f.weight, f.style = parseFamilies(rest), weight, style
+			return
+		case token.Type == css.Number, token.Is(css.Ident, "bold"), token.Is(css.Ident, "bolder"), token.Is(css.Ident, "lighter"):
+			weight = parseWeight([]css.Token{token}, parent.weight)
+		}
+	}
+}
+
+func parseFamilies(value []css.Token) []string {
+	families := make([]string, 0)
+	for _, part := range css.SplitCommas(value) {
+		if name := familyName(part); len(name) > 0 {
+			families = append(families, name)
+		}
+	}
+	return families
+}
+
+func parseWeight(value []css.Token, parent float64) float64 {
+	if len(value) != 1 {
+		return 0
+	}
+	switch token := value[0]; {
+	case token.Type == css.Number:
+		return token.Number
+	case token.Is(css.Ident, "normal"):
+		return 400
+	case token.Is(css.Ident, "bold"):
+		return 700
+	case parent == 0:
+		return 0
+	case token.Is(css.Ident, "bolder"):
+		switch {
+		case parent < 350:
+			return 400
+		case parent < 550:
+			return 700
+		default:
+			return max(parent, 900)
+		}
+	case token.Is(css.Ident, "lighter"):
+		switch {
+		case parent < 100:
+			return parent
+		case parent < 550:
+			return 100
+		case parent < 750:
+			return 400
+		default:
+			return 700
+		}
+	}
+	return 0
+}
+
+func parseStyle(value []css.Token) string {
+	if len(value) == 0 || value[0].Type != css.Ident {
+		return ""
+	}
+	style := strings.ToLower(value[0].Value)
+	if _, ok := fontStyleOrder[style]; !ok {
+		return ""
+	}
+	return style
+}
+
+// substituteVars replaces the var() references of the value with the
+// custom properties, or their fallbacks. It reports false if a reference
+// cannot be resolved.
+func substituteVars(value []css.Token, vars map[string][]css.Token, depth int) ([]css.Token, bool) {
+	if depth > maxVarDepth {
+		return nil, false
+	}
+	substituted := make([]css.Token, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if !value[i].Is(css.Function, "var") {
+			substituted = append(substituted, value[i])
+			continue
+		}
+		args, end := functionArgs(value, i)
+		i = end
+		if len(args) == 0 || args[0].Type != css.Ident {
+			return nil, false
+		}
+		replacement, ok := vars[args[0].Value]
+		if !ok {
+			rest := css.Trim(args[1:])
+			if len(rest) == 0 || rest[0].Type != css.Comma {
+				return nil, false
+			}
+			replacement = rest[1:]
+		}
+		replacement, ok = substituteVars(replacement, vars, depth+1)
+		if !ok {
+			return nil, false
+		}
+		substituted = append(substituted, replacement...)
+	}
+	return substituted, true
+}
+
+func (p *fontPruner) use(style *fontStyle, runes map[rune]bool) []fontUsage {
+	usages := make([]fontUsage, 0, len(style.families))
+	for _, family := range style.families {
+		if _, ok := p.faces[family]; !ok {
+			continue
+		}
+		u := fontUsage{family: family, weight: style.weight, style: style.style, runes: runes}
+		usages = append(usages, u)
+		key := fontKey{family: u.family, weight: u.weight, style: u.style}
+		known, ok := p.usages[key]
+		switch {
+		case !ok:
+			p.usages[key] = maps.Clone(runes)
+		case known != nil && runes != nil:
+			maps.Copy(known, runes)
+		case runes == nil:
+			p.usages[key] = nil
+		}
+	}
+	return usages
+}
+
+// match marks the faces the used fonts select.
+func (p *fontPruner) match() {
+	for family := range p.keep {
+		for _, face := range p.faces[family] {
+			face.used = true
+		}
+	}
+	for usage, runes := range p.usages {
+		faces := slices.Collect(maps.Values(p.faces[usage.family]))
+		if usage.weight > 0 && len(usage.style) > 0 {
+			faces = selectFaces(faces, usage.weight, usage.style)
+		}
+		for _, face := range faces {
+			if face.covers(runes) {
+				face.used = true
+			}
+		}
+	}
+}
+
+// selectFaces returns the faces the font matching algorithm selects for
+// the weight and the style. Faces which only differ in their unicode
+// ranges are all returned.
+func selectFaces(faces []*fontFace, weight float64, style string) []*fontFace {
+	for _, s := range fontStyleOrder[style] {
+		candidates := slices.DeleteFunc(slices.Clone(faces), func(face *fontFace) bool {
+			return face.style != s
+		})
+		if len(candidates) == 0 {
+			continue
+		}
+		best := slices.MinFunc(candidates, func(a, b *fontFace) int {
+			return compareWeightRank(weightRank(weight, a.weight), weightRank(weight, b.weight))
+		})
+		return slices.DeleteFunc(candidates, func(face *fontFace) bool {
+			return face.weight != best.weight
+		})
+	}
+	return nil
+}
+
+// weightRank returns the preference tier and the distance of a face with
+// the weight range for the desired weight, lower is better.
+func weightRank(desired float64, weight [2]float64) [2]float64 {
+	lo, hi := weight[0], weight[1]
+	switch {
+	case lo <= desired && desired <= hi:
+		return [2]float64{0, 0}
+	case desired >= 400 && desired <= 500:
+		switch {
+		case lo > desired && lo <= 500:
+			return [2]float64{1, lo - desired}
+		case hi < desired:
+			return [2]float64{2, desired - hi}
+		default:
+			return [2]float64{3, lo - desired}
+		}
+	case desired < 400:
+		if hi < desired {
+			return [2]float64{1, desired - hi}
+		}
+		return [2]float64{2, lo - desired}
+	default:
+		if lo > desired {
+			return [2]float64{1, lo - desired}
+		}
+		return [2]float64{2, desired - hi}
+	}
+}
+
+func compareWeightRank(a, b [2]float64) int {
+	return cmp.Or(cmp.Compare(a[0], b[0]), cmp.Compare(a[1], b[1]))
+}
+
+func newFontFace(block []css.Token) *fontFace {
+	face := &fontFace{style: "normal", weight: [2]float64{400, 400}}
+	for _, d := range css.ParseDeclarations(block) {
+		switch {
+		case d.Is("font-family"):
+			face.family = familyName(d.Value)
+		case d.Is("font-style"):
+			if style := parseStyle(d.Value); len(style) > 0 {
+				face.style = style
+			}
+		case d.Is("font-weight"):
+			face.weight = parseWeightRange(d.Value)
+		case d.Is("unicode-range"):
+			face.ranges = parseUnicodeRanges(css.Serialize(d.Value))
+		}
+	}
+	return face
+}
+
+func parseWeightRange(value []css.Token) [2]float64 {
+	weights := make([]float64, 0, 2)
+	for _, token := range value {
+		switch {
+		case token.Is(css.Ident, "auto"):
+			return [2]float64{1, 1000}
+		case token.Type == css.Number, token.Type == css.Ident:
+			if w := parseWeight([]css.Token{token}, 400); w > 0 {
+				weights = append(weights, w)
+			}
+		}
+	}
+	switch len(weights) {
+	case 1:
+		return [2]float64{weights[0], weights[0]}
+	case 2:
+		return [2]float64{min(weights[0], weights[1]), max(weights[0], weights[1])}
+	default:
+		return [2]float64{400, 400}
+	}
+}
+
+// parseUnicodeRanges parses the unicode-range descriptor, it returns nil,
+// which means every code point, if the descriptor is invalid.
+func parseUnicodeRanges(s string) [][2]rune {
+	ranges := make([][2]rune, 0)
+	for _, part := range strings.Split(strings.Join(strings.Fields(s), ""), ",") {
+		part = strings.ToLower(part)
+		if !strings.HasPrefix(part, "u+") {
+			return nil
+		}
+		part = part[2:]
+		lo, hi, ok := strings.Cut(part, "-")
+		if !ok {
+			lo = strings.ReplaceAll(part, "?", "0")
+			hi = strings.ReplaceAll(part, "?", "f")
+		}
+		from, err := strconv.ParseUint(lo, 16, 32)
+		if err != nil {
+			return nil
+		}
+		to, err := strconv.ParseUint(hi, 16, 32)
+		if err != nil {
+			return nil
+		}
+		ranges = append(ranges, [2]rune{rune(from), rune(to)})
+	}
+	return ranges
+}
+
+// covers reports whether the face covers any of the runes, nil runes are
+// unknown and covered by every face.
+func (f *fontFace) covers(runes map[rune]bool) bool {
+	if runes == nil || f.ranges == nil {
+		return true
+	}
+	for r := range runes {
+		for _, rng := range f.ranges {
+			if rng[0] <= r && r <= rng[1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// textRunes returns the characters of the text children of the element in
+// both cases, since text-transform may change the case.
+func textRunes(node *html.Node) map[rune]bool {
+	runes := make(map[rune]bool)
+	for _, child := range node.Children() {
+		if !child.IsText() {
+			continue
+		}
+		for _, r := range child.Text() {
+			if !unicode.IsSpace(r) {
+				runes[r] = true
+				runes[unicode.ToUpper(r)] = true
+				runes[unicode.ToLower(r)] = true
+			}
+		}
+	}
+	return runes
+}
+
+// contentRunes returns the characters of the content property of the
+// matching rules of a ::before or ::after pseudo-element. It reports false
+// if the pseudo-element has no content, and returns nil runes if the
+// content is generated.
+func contentRunes(matches []ruleMatch) (map[rune]bool, bool) {
+	var content *css.Declaration
+	var rank [3]int
+	order := math.MinInt
+	for _, m := range matches {
+		for _, d := range m.rule.declarations {
+			if d.Is("content") && (content == nil || slices.Compare(m.specificity[:], rank[:]) > 0 ||
+				(m.specificity == rank && m.rule.order > order)) {
+				content, rank, order = d, m.specificity, m.rule.order
+			}
+		}
+	}
+	if content == nil {
+		return nil, false
+	}
+	runes := make(map[rune]bool)
+	for _, token := range content.Value {
+		switch {
+		case token.Type == css.String:
+			for _, r := range token.Value {
+				runes[r] = true
+			}
+		case token.Is(css.Ident, "none"), token.Is(css.Ident, "normal"):
+			if len(content.Value) == 1 {
+				return nil, false
+			}
+		case token.Type == css.Whitespace, token.Type == css.Comment, token.Is(css.Delim, "/"):
+		default:
+			return nil, true
+		}
+	}
+	return runes, true
+}
@@ -0,0 +1,104 @@
+package transform_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestPruneFonts(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><head><style>
+@font-face { font-family: Text; font-weight: 400; src: url(data:font/woff2;base64,AA==) }
+@font-face { font-family: Text; font-weight: 700; src: url(data:font/woff2;base64,AQ==) }
+@font-face { font-family: Text; font-weight: 300; src: url(data:font/woff2;base64,Ag==) }
+@font-face { font-family: Text; font-style: italic; src: url(data:font/woff2;base64,Aw==) }
+@font-face { font-family: Text; unicode-range: U+0400-04FF; src: url(data:font/woff2;base64,BA==) }
+@font-face { font-family: Icons; src: url(data:font/woff2;base64,BQ==) }
+@font-face { font-family: Hover; src: url(data:font/woff2;base64,Bg==) }
+@font-face { font-family: Unused; src: url(data:font/woff2;base64,Bw==) }
+:root { --heading: Text }
+body { font-family: Text, sans-serif }
+h1 { font-weight: bold; font-family: var(--heading) }
+a:hover { font-family: Hover }
+.icon::before { font-family: Icons; content: "\e900" }
+.light { font-weight: 300 }
+</style></head><body><h1>Title</h1><p>text <a href="/">link</a><i class="icon"></i></p></body></html>`,
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.PruneFonts()}
+	})
+	style, err := root.Find(html.IsTag("style"))
+	bee.Nil(err)
+	bee.Equal(normalizeCSS(style.Text()), normalizeCSS(`
+@font-face { font-family: Text; font-weight: 400; src: url(data:font/woff2;base64,AA==) }
+@font-face { font-family: Text; font-weight: 700; src: url(data:font/woff2;base64,AQ==) }
+@font-face { font-family: Icons; src: url(data:font/woff2;base64,BQ==) }
+@font-face { font-family: Hover; src: url(data:font/woff2;base64,Bg==) }
+:root { --heading: Text }
+body { font-family: Text, sans-serif }
+h1 { font-weight: bold; font-family: var(--heading) }
+a:hover { font-family: Hover }
+.icon::before { font-family: Icons; content: "\e900" }
+.light { font-weight: 300 }
+`))
+}
+
+func TestPruneFontsDefaultStyles(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><head><style>
+@font-face { font-family: Text; font-weight: 400; src: url(data:font/woff2;base64,AA==) }
+@font-face { font-family: Text; font-weight: 700; src: url(data:font/woff2;base64,AQ==) }
+@font-face { font-family: Text; font-style: italic; src: url(data:font/woff2;base64,Ag==) }
+@font-face { font-family: Text; font-weight: 700; font-style: italic; src: url(data:font/woff2;base64,Aw==) }
+@font-face { font-family: Symbols; unicode-range: U+2600-26FF; src: url(data:font/woff2;base64,BA==) }
+body { font-family: Text, Symbols }
+</style></head><body><h2>Title</h2><p>Some <em>text</em> <strong>bold ★</strong></p></body></html>`,
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.PruneFonts()}
+	})
+	style, err := root.Find(html.IsTag("style"))
+	bee.Nil(err)
+	bee.Equal(normalizeCSS(style.Text()), normalizeCSS(`
+@font-face { font-family: Text; font-weight: 400; src: url(data:font/woff2;base64,AA==) }
+@font-face { font-family: Text; font-weight: 700; src: url(data:font/woff2;base64,AQ==) }
+@font-face { font-family: Text; font-style: italic; src: url(data:font/woff2;base64,Ag==) }
+@font-face { font-family: Symbols; unicode-range: U+2600-26FF; src: url(data:font/woff2;base64,BA==) }
+body { font-family: Text, Symbols }
+`))
+}
+
+func TestPruneFontsDeepStateRules(t *testing.T) {
+	bee := bee.New(t)
+	depth := 200
+	srv := newServer(map[string]string{
+		"/index.html": `<html><head><style>
+@font-face { font-family: Text; font-weight: 400; src: url(data:font/woff2;base64,AA==) }
+@font-face { font-family: Text; font-weight: 700; src: url(data:font/woff2;base64,AQ==) }
+@font-face { font-family: Text; font-weight: 300; src: url(data:font/woff2;base64,Ag==) }
+body { font-family: Text }
+div:hover { font-weight: 700 }
+</style></head><body>` + strings.Repeat("<div>text", depth) + strings.Repeat("</div>", depth) + `</body></html>`,
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.PruneFonts()}
+	})
+	style, err := root.Find(html.IsTag("style"))
+	bee.Nil(err)
+	bee.Equal(normalizeCSS(style.Text()), normalizeCSS(`
+@font-face { font-family: Text; font-weight: 400; src: url(data:font/woff2;base64,AA==) }
+@font-face { font-family: Text; font-weight: 700; src: url(data:font/woff2;base64,AQ==) }
+body { font-family: Text }
+div:hover { font-weight: 700 }
+`))
+}
@@ -19,14 +19,26 @@ func RemoveTags(tags ...string) Transformer {
 
 func ResolveLinks(baseURL *url.URL) Transformer {
 	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
-		targets := map[string]string{
-			"link":   "href",
-			"a":      "href",
-			"script": "src",
-			"img":    "src",
+		targets := map[string][]string{
+			"link":   {"href"},
+			"a":      {"href"},
+			"script": {"src"},
+			"img":    {"src"},
+			"video":  {"src", "poster"},
+			"audio":  {"src"},
+			"source": {"src"},
+			"track":  {"src"},
 		}
-		for tag, attr := range targets {
-			if err := resolveLink(node, baseURL, tag, attr); err != nil {
+		docURL := documentBaseURL(node, baseURL)
+		for tag, attrs := range targets {
+			for _, attr := range attrs {
+				if err := resolveLink(node, baseURL, docURL, tag, attr); err != nil {
+					return err
+				}
+			}
+		}
+		for _, tag := range []string{"img", "source"} {
+			if err := resolveSrcset(node, docURL, tag); err != nil {
 				return err
 			}
 		}
@@ -34,10 +46,30 @@ func ResolveLinks(baseURL *url.URL) Transformer {
 	})
 }
 
-func resolveLink(node *html.Node, baseURL *url.URL, tag string, attr string) error {
+func resolveSrcset(node *html.Node, docURL *url.URL, tag string) error {
+	for n := range node.FindAll(html.IsTag(tag)) {
+		srcset, ok := n.GetAttr("srcset")
+		if !ok {
+			continue
+		}
+		candidates := parseSrcset(srcset)
+		for i, c := range candidates {
+			link, err := resolveRef(docURL, c.url)
+			if err != nil {
+				return err
+			}
+			candidates[i].url = link
+		}
+		n.DeleteAttr("srcset")
+		n.SetAttr("srcset", serializeSrcset(candidates))
+	}
+	return nil
+}
+
+func resolveLink(node *html.Node, baseURL *url.URL, docURL *url.URL, tag string, attr string) error {
 	for n := range node.FindAll(html.IsTag(tag)) {
 		if v, ok := n.GetAttr(attr); ok {
-			v, err := resolveRef(baseURL, v)
+			v, err := resolveRef(docURL, v)
 			if err != nil {
 				return err
 			}
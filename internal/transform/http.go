@@ -3,17 +3,29 @@ package transform
 import (
 	"encoding/base64"
 	"fmt"
+	"net/url"
+	"path"
+	"slices"
 	"strings"
-
-	"github.com/danielrenes/htdl/internal/http"
 )
 
-func downloadAndBase64Encode(link string) (string, error) {
-	data, err := http.Download(link)
+func downloadAndBase64Encode(ctx *TransformerContext, link string) (string, error) {
+	mimeType, err := mimeTypeOf(link)
+	if err != nil {
+		return "", err
+	}
+	data, err := ctx.download(link, mimeType)
 	if err != nil {
 		return "", err
 	}
-	b64Data := base64.StdEncoding.EncodeToString(data)
+	return dataURL(mimeType, data), nil
+}
+
+func dataURL(mimeType string, data []byte) string {
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data))
+}
+
+func mimeTypeOf(link string) (string, error) {
 	idx := strings.LastIndex(link, ".")
 	if idx < 0 {
 		return "", fmt.Errorf("extension not found: %s", link)
@@ -24,10 +36,14 @@ func downloadAndBase64Encode(link string) (string, error) {
 	}
 	var dataType string
 	switch ext {
-	case "png", "jpg", "jpeg", "svg":
+	case "png", "jpg", "jpeg", "gif", "webp", "avif", "svg", "ico":
 		dataType = "image"
 	case "otf", "ttf", "woff", "woff2":
 		dataType = "font"
+	case "mp4", "webm", "ogv", "mov":
+		dataType = "video"
+	case "mp3", "oga", "ogg", "wav", "m4a", "flac", "opus":
+		dataType = "audio"
 	default:
 		dataType = "text"
 	}
@@ -37,9 +53,43 @@ func downloadAndBase64Encode(link string) (string, error) {
 		mimeType = "jpeg"
 	case "svg":
 		mimeType = "svg+xml"
+	case "ico":
+		mimeType = "x-icon"
+	case "mp3":
+		mimeType = "mpeg"
+	case "ogv", "oga", "opus":
+		mimeType = "ogg"
+	case "m4a":
+		mimeType = "mp4"
+	case "mov":
+		mimeType = "quicktime"
 	default:
 		mimeType = ext
 	}
-	src := fmt.Sprintf("data:%s/%s;base64,%s", dataType, mimeType, b64Data)
-	return src, nil
+	return fmt.Sprintf("%s/%s", dataType, mimeType), nil
+}
+
+// responseMIMEType returns the MIME type of the fetched link by the
+// extension of its path if it is of one of the kinds, like image, or else
+// by the content type of the response if that is, as resources generated
+// on request often have no or a misleading extension.
+func responseMIMEType(link string, contentType string, kinds ...string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("parse URL from %s: %w", link, err)
+	}
+	isKind := func(mimeType string) bool {
+		kind, _, _ := strings.Cut(mimeType, "/")
+		return slices.Contains(kinds, kind)
+	}
+	if len(path.Ext(u.Path)) > 0 {
+		if mimeType, err := mimeTypeOf(u.Path); err == nil && isKind(mimeType) {
+			return mimeType, nil
+		}
+	}
+	mimeType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	if mimeType = strings.TrimSpace(mimeType); !isKind(mimeType) {
+		return "", fmt.Errorf("unknown %s type of %s: %s", strings.Join(kinds, " or "), link, contentType)
+	}
+	return mimeType, nil
 }
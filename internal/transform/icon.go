@@ -0,0 +1,176 @@
+package transform
+
+import (
+	"log/slog"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+// iconRels are the link types of the icons in order of preference, the
+// mask icons of pinned tabs are only used if there is no other icon.
+var iconRels = [][]string{{"icon", "apple-touch-icon", "apple-touch-icon-precomposed"}, {"mask-icon"}}
+
+type icon struct {
+	node  *html.Node
+	href  string
+	size  float64
+	order int
+}
+
+// InlineIcons replaces the icon links of the document with one icon link
+// with a data URL, so tabs and bookmarks of the archive show the icon of
+// the page. The icon is selected like image-set() candidates, with the
+// smallest size not below the size, or the largest one if the size is
+// zero. Icons which fail to load are skipped, and /favicon.ico is tried if
+// the document has no icon.
+func InlineIcons(baseURL *url.URL, size int) Transformer {
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		head, err := node.Find(html.IsTag("head"))
+		if err != nil {
+			return nil
+		}
+		icons := findIcons(node)
+		if len(icons) == 0 {
+			favicon, err := resolveRef(baseURL, "/favicon.ico")
+			if err != nil {
+				return err
+			}
+			icons = append(icons, &icon{href: favicon})
+		}
+		slices.SortStableFunc(icons, func(a, b *icon) int {
+			switch {
+			case a.order != b.order:
+				return a.order - b.order
+			case preferAtLeast(a.size, b.size, float64(size)):
+				return -1
+			case preferAtLeast(b.size, a.size, float64(size)):
+				return 1
+			default:
+				return 0
+			}
+		})
+		var selected *icon
+		var src string
+		for _, i := range icons {
+			if selected != nil {
+				if !strings.HasPrefix(i.href, "data:") {
+					ctx.skip(i.href, "not the selected icon")
+				}
+				continue
+			}
+			if strings.HasPrefix(i.href, "data:") {
+				selected, src = i, i.href
+				continue
+			}
+			resp, err := ctx.fetch(i.href)
+			if err != nil {
+				slog.Debug("Skip icon", slog.String("href", i.href), slog.String("error", err.Error()))
+				continue
+			}
+			mimeType, err := iconMIMEType(i, resp.ContentType)
+			if err != nil {
+				slog.Debug("Skip icon", slog.String("href", i.href), slog.String("error", err.Error()))
+				continue
+			}
+			data, err := ctx.download(i.href, mimeType)
+			if err != nil {
+				slog.Debug("Skip icon", slog.String("href", i.href), slog.String("error", err.Error()))
+				continue
+			}
+			slog.Debug("Inline icon", slog.String("href", i.href))
+			selected, src = i, dataURL(mimeType, data)
+		}
+		if selected == nil {
+			return nil
+		}
+		attrs := map[string]string{"rel": "icon", "href": src}
+		if selected.node != nil {
+			if sizes, ok := selected.node.GetAttr("sizes"); ok {
+				attrs["sizes"] = sizes
+			}
+		}
+		link := html.NewNode("link", attrs, "")
+		if first := slices.IndexFunc(icons, func(i *icon) bool { return i.node != nil }); first >= 0 {
+			for _, i := range icons {
+				if i.node != nil && i.node != icons[first].node {
+					i.node.Remove()
+				}
+			}
+			icons[first].node.ReplaceWith(link)
+		} else {
+			head.AppendChild(link)
+		}
+		return nil
+	})
+}
+
+func findIcons(node *html.Node) []*icon {
+	icons := make([]*icon, 0)
+	for order, rels := range iconRels {
+		links := node.FindAll(html.IsTag("link"), html.NodeFilterFunc(func(n *html.Node) bool {
+			return slices.ContainsFunc(rels, func(rel string) bool {
+				return html.HasToken("rel", rel).Eval(n)
+			})
+		}))
+		for n := range links {
+			href, ok := n.GetAttr("href")
+			if !ok || len(strings.TrimSpace(href)) == 0 {
+				continue
+			}
+			icons = append(icons, &icon{node: n, href: strings.TrimSpace(href), size: iconSize(n), order: order})
+		}
+	}
+	return icons
+}
+
+// iconSize returns the largest size of the sizes attribute, any is larger
+// than every size. Apple touch icons default to 180 pixels, other icons
+// without sizes are assumed to be the smallest.
+func iconSize(node *html.Node) float64 {
+	sizes, ok := node.GetAttr("sizes")
+	if !ok {
+		for _, rel := range []string{"apple-touch-icon", "apple-touch-icon-precomposed"} {
+			if html.HasToken("rel", rel).Eval(node) {
+				return 180
+			}
+		}
+		return 0
+	}
+	size := 0.0
+	for _, s := range strings.Fields(strings.ToLower(sizes)) {
+		if s == "any" {
+			return math.Inf(1)
+		}
+		w, h, ok := strings.Cut(s, "x")
+		if !ok {
+			continue
+		}
+		width, err := strconv.Atoi(w)
+		if err != nil {
+			continue
+		}
+		height, err := strconv.Atoi(h)
+		if err != nil {
+			continue
+		}
+		size = max(size, float64(max(width, height)))
+	}
+	return size
+}
+
+// iconMIMEType returns the type of the link element of the icon, or else
+// the type by its extension or the content type of its response, as icon
+// endpoints like /icon?size=32 often have no extension.
+func iconMIMEType(i *icon, contentType string) (string, error) {
+	if i.node != nil {
+		if typ, ok := i.node.GetAttr("type"); ok && strings.HasPrefix(strings.ToLower(typ), "image/") {
+			return strings.ToLower(typ), nil
+		}
+	}
+	return responseMIMEType(i.href, contentType, "image")
+}
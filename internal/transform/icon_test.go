@@ -0,0 +1,50 @@
+package transform_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestInlineIcons(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><head>
+<link rel="shortcut icon" href="/favicon-16.png" sizes="16x16">
+<link rel="icon" href="/favicon-32.png" sizes="32x32">
+<link rel="apple-touch-icon" href="/touch.png">
+<link rel="mask-icon" href="/mask.svg" color="#000">
+</head><body></body></html>`,
+		"/bare.html":      `<html><head></head><body></body></html>`,
+		"/endpoint.html":  `<html><head><link rel="icon" href="/icon?size=32"></head><body></body></html>`,
+		"/icon":           "\x89PNG\r\n\x1a\nicon",
+		"/favicon-16.png": "16",
+		"/favicon-32.png": "32",
+		"/favicon.ico":    "ico",
+	})
+	defer srv.Close()
+	tests := []struct {
+		page     string
+		size     int
+		expected string
+	}{
+		{"/index.html", 0, `<link href="` + imageDataURL("png", "32") + `" rel="icon" sizes="32x32"/>`},
+		{"/index.html", 20, `<link href="` + imageDataURL("png", "32") + `" rel="icon" sizes="32x32"/>`},
+		{"/index.html", 16, `<link href="` + imageDataURL("png", "16") + `" rel="icon" sizes="16x16"/>`},
+		{"/bare.html", 0, `<link href="` + imageDataURL("x-icon", "ico") + `" rel="icon"/>`},
+		{"/endpoint.html", 0, `<link href="` + imageDataURL("png", "\x89PNG\r\n\x1a\nicon") + `" rel="icon"/>`},
+	}
+	for _, test := range tests {
+		root := runPipeline(bee, srv.URL+test.page, func(baseURL *url.URL) []transform.Transformer {
+			return []transform.Transformer{transform.ResolveLinks(baseURL), transform.InlineIcons(baseURL, test.size)}
+		})
+		links := make([]string, 0)
+		for link := range root.FindAll(html.IsTag("link")) {
+			links = append(links, link.RenderString())
+		}
+		bee.Equal(links, []string{test.expected})
+	}
+}
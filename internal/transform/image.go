@@ -1,88 +1,297 @@
 package transform
 
 import (
-	"iter"
 	"log/slog"
+	"slices"
 	"strings"
 
 	"github.com/danielrenes/htdl/internal/html"
 )
 
-func InlineImages() Transformer {
+var DefaultImageTypes = []string{"image/avif", "image/webp", "image/jpeg", "image/png", "image/gif", "image/svg+xml"}
+
+type PicturePolicy int
+
+const (
+	// PictureCollapse inlines the selected source of a picture element into
+	// its img element and removes the source elements.
+	PictureCollapse PicturePolicy = iota
+	// PictureInline inlines the source elements with a supported type and
+	// removes the others, so the browser still selects a source by media.
+	PictureInline
+)
+
+func (p PicturePolicy) String() string {
+	switch p {
+	case PictureInline:
+		return "inline"
+	default:
+		return "collapse"
+	}
+}
+
+type ImageOptions struct {
+	// Candidate selects the srcset candidate inlined as the src.
+	Candidate CandidatePolicy
+	// Candidates is the number of candidates, in order of preference, kept
+	// in a rewritten srcset as data URLs. The srcset is removed if it is
+	// less than two.
+	Candidates int
+	// Types are the image MIME types the sources of picture elements are
+	// selected from, it defaults to DefaultImageTypes. Sources without a
+	// type attribute are assumed to be supported.
+	Types []string
+	// Picture is the policy for the source elements of picture elements.
+	Picture PicturePolicy
+	// MaxWidth downscales the PNG, JPEG and GIF images wider than it, zero
+	// keeps every size.
+	MaxWidth int
+	// JPEGQuality re-encodes the JPEG images with the quality, downscaled
+	// JPEG images default to DefaultJPEGQuality. Zero keeps the originals.
+	JPEGQuality int
+	// LazyAttributes are the attributes ResolveLazyImages promotes to src
+	// and srcset in order, it defaults to DefaultLazyAttributes.
+	LazyAttributes []string
+}
+
+func (o ImageOptions) withDefaults() ImageOptions {
+	if len(o.Types) == 0 {
+		o.Types = DefaultImageTypes
+	}
+	if len(o.LazyAttributes) == 0 {
+		o.LazyAttributes = DefaultLazyAttributes
+	}
+	return o
+}
+
+// InlineImages inlines the selected candidates of the img elements. The
+// picture elements are handled as a unit: the first source with a supported
+// type and a matching media query, or else the img element itself, is
+// inlined into the img element.
+func InlineImages(opts ImageOptions) Transformer {
+	opts = opts.withDefaults()
 	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
-		iters := []iter.Seq[*html.Node]{
-			node.FindAll(html.IsTag("img")),
-			findSourceTagsWithImageType(node),
-		}
-		for _, iter := range iters {
-			for n := range iter {
-				if err := inlineImage(n); err != nil {
-					return err
-				}
+		pictures := slices.Collect(node.FindAll(html.IsTag("picture")))
+		for _, n := range pictures {
+			if err := inlinePicture(n, ctx, opts); err != nil {
+				return err
+			}
+		}
+		images := slices.Collect(node.FindAll(html.IsTag("img")))
+		for _, n := range images {
+			if parent := n.Parent(); parent != nil && parent.Tag() == "picture" {
+				continue
+			}
+			if err := inlineImage(n, ctx, opts); err != nil {
+				return err
 			}
 		}
 		return nil
 	})
 }
 
-func inlineImage(node *html.Node) error {
-	src, ok := getSource(node)
-	if !ok {
+func inlinePicture(node *html.Node, ctx *TransformerContext, opts ImageOptions) error {
+	var img *html.Node
+	sources := make([]*html.Node, 0)
+	for _, child := range node.Children() {
+		if child.Tag() == "img" {
+			img = child
+			break
+		}
+		if child.Tag() == "source" {
+			sources = append(sources, child)
+		}
+	}
+	if img == nil {
 		return nil
 	}
-	slog.Debug("Inline image", slog.String("src", src))
-	newSrc, err := downloadAndBase64Encode(src)
+	var selected *html.Node
+	for _, source := range sources {
+		if selected == nil && opts.supports(source) && matchesMedia(source) && len(imageCandidates(source)) > 0 {
+			selected = source
+		}
+	}
+	candidates := imageCandidates(img)
+	if selected != nil {
+		skipCandidates(ctx, candidates, "not the selected picture source")
+		candidates = imageCandidates(selected)
+		img.DeleteAttr("sizes")
+		if sizes, ok := selected.GetAttr("sizes"); ok {
+			img.SetAttr("sizes", sizes)
+		}
+	}
+	for _, source := range sources {
+		switch {
+		case len(imageCandidates(source)) == 0:
+			// A source without candidates, like one with a lazy loading
+			// attribute only, can never be selected.
+		case opts.Picture == PictureInline && opts.supports(source):
+			src, srcset, err := selectCandidates(imageCandidates(source), ctx, opts)
+			if err != nil {
+				return err
+			}
+			if len(srcset) == 0 {
+				srcset = []imageCandidate{{url: src}}
+			}
+			source.DeleteAttr("src")
+			source.DeleteAttr("srcset")
+			source.SetAttr("srcset", serializeSrcset(srcset))
+			continue
+		case opts.Picture == PictureInline:
+			skipCandidates(ctx, imageCandidates(source), "unsupported picture source type")
+		case source != selected:
+			skipCandidates(ctx, imageCandidates(source), "not the selected picture source")
+		}
+		source.Remove()
+	}
+	return inlineCandidates(img, candidates, ctx, opts)
+}
+
+func inlineImage(node *html.Node, ctx *TransformerContext, opts ImageOptions) error {
+	return inlineCandidates(node, imageCandidates(node), ctx, opts)
+}
+
+// inlineCandidates inlines the preferred candidate as the src of the img
+// element, and the kept candidates into its srcset.
+func inlineCandidates(node *html.Node, candidates []imageCandidate, ctx *TransformerContext, opts ImageOptions) error {
+	if len(candidates) == 0 {
+		return nil
+	}
+	src, srcset, err := selectCandidates(candidates, ctx, opts)
 	if err != nil {
 		return err
 	}
 	node.DeleteAttr("src")
 	node.DeleteAttr("srcset")
-	node.SetAttr("src", newSrc)
+	node.SetAttr("src", src)
+	if len(srcset) > 0 {
+		node.SetAttr("srcset", serializeSrcset(srcset))
+	}
 	return nil
 }
 
-func findSourceTagsWithImageType(node *html.Node) iter.Seq[*html.Node] {
-	return func(yield func(*html.Node) bool) {
-		for n := range node.FindAll(html.IsTag("source")) {
-			if v, ok := n.GetAttr("type"); ok && strings.HasPrefix(v, "image/") {
-				if !yield(n) {
-					return
-				}
-				continue
-			}
-			src, ok := getSource(n)
-			if !ok {
-				continue
-			}
-			idx := strings.LastIndex(src, ".")
-			if idx < 0 {
-				continue
-			}
-			ext := src[idx+1:]
-			if idx := strings.Index(ext, "?"); idx > 0 {
-				ext = ext[:idx]
-			}
-			if ext != "jpg" && ext != "jpeg" && ext != "png" && ext != "svg" {
-				continue
-			}
-			if !yield(n) {
-				return
-			}
+// selectCandidates returns the data URL of the preferred candidate and, if
+// more than one candidate is kept, the kept candidates with data URLs.
+func selectCandidates(candidates []imageCandidate, ctx *TransformerContext, opts ImageOptions) (string, []imageCandidate, error) {
+	if len(candidates) == 0 {
+		return "", nil, nil
+	}
+	sortCandidates(candidates, opts.Candidate)
+	keep := min(max(opts.Candidates, 1), len(candidates))
+	inlined, err := downloadCandidates(ctx, candidates[:keep], opts)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, c := range candidates[keep:] {
+		if _, ok := inlined[c.url]; !ok && !strings.HasPrefix(c.url, "data:") {
+			ctx.skip(c.url, "not the selected srcset candidate")
+		}
+	}
+	if keep < 2 {
+		return inlined[candidates[0].url], nil, nil
+	}
+	kept := slices.Clone(candidates[:keep])
+	for i := range kept {
+		kept[i].url = inlined[kept[i].url]
+	}
+	return kept[0].url, kept, nil
+}
+
+// downloadCandidates returns the data URLs of the candidates by their URLs,
+// optimizing the images. Candidates which are data URLs already are kept
+// as they are.
+func downloadCandidates(ctx *TransformerContext, candidates []imageCandidate, opts ImageOptions) (map[string]string, error) {
+	inlined := make(map[string]string)
+	for _, c := range candidates {
+		if _, ok := inlined[c.url]; ok {
+			continue
+		}
+		if strings.HasPrefix(c.url, "data:") {
+			inlined[c.url] = c.url
+			continue
+		}
+		slog.Debug("Inline image", slog.String("src", c.url))
+		// Image CDN URLs often have no extension, their type is known
+		// from the response.
+		resp, err := ctx.fetch(c.url)
+		if err != nil {
+			return nil, err
 		}
+		mimeType, err := responseMIMEType(c.url, resp.ContentType, "image")
+		if err != nil {
+			return nil, err
+		}
+		data, err := ctx.download(c.url, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		optimized, optimizedType := optimizeImage(data, mimeType, opts)
+		if saved := len(data) - len(optimized); saved > 0 {
+			ctx.save(saved)
+		}
+		inlined[c.url] = dataURL(optimizedType, optimized)
 	}
+	return inlined, nil
+}
+
+func sortCandidates(candidates []imageCandidate, policy CandidatePolicy) {
+	slices.SortStableFunc(candidates, func(a, b imageCandidate) int {
+		switch {
+		case policy.prefer(a, b):
+			return -1
+		case policy.prefer(b, a):
+			return 1
+		default:
+			return 0
+		}
+	})
 }
 
-func getSource(node *html.Node) (string, bool) {
-	if src, ok := node.GetAttr("src"); ok {
-		return src, true
+func skipCandidates(ctx *TransformerContext, candidates []imageCandidate, reason string) {
+	for _, c := range candidates {
+		if !strings.HasPrefix(c.url, "data:") {
+			ctx.skip(c.url, reason)
+		}
 	}
+}
+
+// imageCandidates returns the candidates of the srcset attribute, and the
+// src attribute of img elements as a 1x candidate unless the srcset has
+// widths or a 1x candidate, with their widths and densities resolved for
+// the source size.
+func imageCandidates(node *html.Node) []imageCandidate {
+	candidates := make([]imageCandidate, 0)
 	if srcset, ok := node.GetAttr("srcset"); ok {
-		srcs := strings.Split(srcset, ",")
-		src := strings.TrimSpace(srcs[len(srcs)-1])
-		if idx := strings.Index(src, " "); idx > 0 {
-			src = strings.TrimSpace(src[:idx])
+		candidates = parseSrcset(srcset)
+	}
+	if src, ok := node.GetAttr("src"); ok && len(src) > 0 && node.Tag() == "img" {
+		if !slices.ContainsFunc(candidates, func(c imageCandidate) bool { return c.width > 0 || c.density == 1 }) {
+			candidates = append(candidates, imageCandidate{url: src, descriptor: "1x", density: 1})
+		}
+	}
+	sizes, _ := node.GetAttr("sizes")
+	size := parseSizes(sizes)
+	for i, c := range candidates {
+		if c.width > 0 {
+			candidates[i].density = c.width / size
+		} else {
+			candidates[i].width = c.density * size
 		}
-		return src, true
 	}
-	return "", false
+	return candidates
+}
+
+// supports reports whether the type of the source element is supported.
+func (o ImageOptions) supports(source *html.Node) bool {
+	typ, ok := source.GetAttr("type")
+	if !ok {
+		return true
+	}
+	typ, _, _ = strings.Cut(typ, ";")
+	return slices.Contains(o.Types, strings.ToLower(strings.TrimSpace(typ)))
+}
+
+func matchesMedia(source *html.Node) bool {
+	media, ok := source.GetAttr("media")
+	return !ok || evalMediaQuery(media)
 }
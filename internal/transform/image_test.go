@@ -0,0 +1,164 @@
+package transform_test
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestInlineImagesSrcset(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body>
+<img id="widths" src="/fallback.png" sizes="(max-width: 600px) 100vw, (min-width: 1000px) 320px, 50vw"
+	srcset="/c_fill,w_320/a.png 320w, /c_fill,w_640/a.png 640w,/c_fill,w_1280/a.png 1280w">
+<img id="densities" src="/b1.png" srcset="/b2.png 2x, /b3.png 3x">
+</body></html>`,
+		"/fallback.png":        "fallback",
+		"/c_fill,w_320/a.png":  "a320",
+		"/c_fill,w_640/a.png":  "a640",
+		"/c_fill,w_1280/a.png": "a1280",
+		"/b1.png":              "b1",
+		"/b2.png":              "b2",
+		"/b3.png":              "b3",
+	})
+	defer srv.Close()
+	tests := []struct {
+		policy    string
+		widths    string
+		densities string
+	}{
+		{"largest", "a1280", "b3"},
+		{"smallest", "a320", "b1"},
+		{"600w", "a640", "b1"},
+		{"2000w", "a1280", "b2"},
+		{"2x", "a640", "b2"},
+		{"1.5x", "a640", "b2"},
+	}
+	for _, test := range tests {
+		policy, err := transform.ParseCandidatePolicy(test.policy)
+		bee.Nil(err)
+		bee.Equal(policy.String(), test.policy)
+		root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+			return []transform.Transformer{
+				transform.ResolveLinks(baseURL),
+				transform.InlineImages(transform.ImageOptions{Candidate: policy}),
+			}
+		})
+		for id, expected := range map[string]string{"widths": test.widths, "densities": test.densities} {
+			img, err := root.Find(html.HasAttr("id", id))
+			bee.Nil(err)
+			src, _ := img.GetAttr("src")
+			bee.Equal(src, imageDataURL("png", expected))
+			_, ok := img.GetAttr("srcset")
+			bee.False(ok)
+		}
+	}
+}
+
+func TestInlineImagesKeepCandidates(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body><img src="/b1.png" srcset="/b2.png 2x, /b3.png 3x"></body></html>`,
+		"/b1.png":     "b1",
+		"/b2.png":     "b2",
+		"/b3.png":     "b3",
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{
+			transform.ResolveLinks(baseURL),
+			transform.InlineImages(transform.ImageOptions{Candidates: 2}),
+		}
+	})
+	img, err := root.Find(html.IsTag("img"))
+	bee.Nil(err)
+	src, _ := img.GetAttr("src")
+	bee.Equal(src, imageDataURL("png", "b3"))
+	srcset, _ := img.GetAttr("srcset")
+	bee.Equal(srcset, imageDataURL("png", "b3")+" 3x, "+imageDataURL("png", "b2")+" 2x")
+}
+
+func TestParseCandidatePolicyInvalid(t *testing.T) {
+	bee := bee.New(t)
+	for _, policy := range []string{"", "biggest", "w", "-2x", "0w", "2y"} {
+		_, err := transform.ParseCandidatePolicy(policy)
+		bee.NotNil(err)
+	}
+}
+
+func TestInlineImagesPicture(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body><picture>
+<source type="image/jxl" srcset="/a.jxl">
+<source type="image/webp" data-srcset="/lazy.webp">
+<source media="(max-width: 600px)" type="image/webp" srcset="/small.webp">
+<source media="(min-width: 601px)" type="image/webp" srcset="/large.webp 1x, /large2.webp 2x">
+<source srcset="/a.jpg">
+<img src="/fallback.jpg">
+</picture></body></html>`,
+		"/small.webp":   "small",
+		"/large.webp":   "large",
+		"/large2.webp":  "large2",
+		"/a.jpg":        "jpg",
+		"/fallback.jpg": "fallback",
+	})
+	defer srv.Close()
+	tests := []struct {
+		opts     transform.ImageOptions
+		expected string
+	}{
+		{
+			transform.ImageOptions{},
+			`<picture><img src="` + imageDataURL("webp", "large2") + `"/></picture>`,
+		},
+		{
+			transform.ImageOptions{Types: []string{"image/jpeg"}, Candidate: transform.CandidatePolicy{Mode: transform.CandidateSmallest}},
+			`<picture><img src="` + imageDataURL("jpeg", "jpg") + `"/></picture>`,
+		},
+		{
+			transform.ImageOptions{Picture: transform.PictureInline},
+			`<picture>
+<source media="(max-width: 600px)" type="image/webp" srcset="` + imageDataURL("webp", "small") + `"/>
+<source media="(min-width: 601px)" type="image/webp" srcset="` + imageDataURL("webp", "large2") + `"/>
+<source srcset="` + imageDataURL("jpeg", "jpg") + `"/>
+<img src="` + imageDataURL("webp", "large2") + `"/>
+</picture>`,
+		},
+	}
+	for _, test := range tests {
+		root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+			return []transform.Transformer{transform.ResolveLinks(baseURL), transform.InlineImages(test.opts)}
+		})
+		picture, err := root.Find(html.IsTag("picture"))
+		bee.Nil(err)
+		bee.Equal(strings.Join(strings.Fields(picture.RenderString()), ""), strings.Join(strings.Fields(test.expected), ""))
+	}
+}
+
+func TestInlineImagesContentType(t *testing.T) {
+	bee := bee.New(t)
+	png := "\x89PNG\r\n\x1a\ncdn"
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body><img src="/img/abc?w=400" srcset="/img/abc?w=800 2x"></body></html>`,
+		"/img/abc":    png,
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.ResolveLinks(baseURL), transform.InlineImages(transform.ImageOptions{})}
+	})
+	img, err := root.Find(html.IsTag("img"))
+	bee.Nil(err)
+	src, _ := img.GetAttr("src")
+	bee.Equal(src, imageDataURL("png", png))
+}
+
+func imageDataURL(typ string, data string) string {
+	return "data:image/" + typ + ";base64," + base64.StdEncoding.EncodeToString([]byte(data))
+}
@@ -0,0 +1,173 @@
+package transform
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/css"
+)
+
+const DefaultMaxImportDepth = 8
+
+type importRule struct {
+	href     string
+	layer    []css.Token
+	hasLayer bool
+	supports []css.Token
+	media    []css.Token
+}
+
+// expandImports replaces the @import rules of the stylesheet with the
+// imported stylesheets, wrapped in @media, @supports and @layer blocks
+// matching the import conditions. Imports are followed recursively up to
+// opts.MaxImportDepth levels, imports which form a cycle are dropped.
+func expandImports(ctx *TransformerContext, sheetURL *url.URL, style string, opts StyleOptions, stack []string) (string, error) {
+	sheet := css.Parse(style)
+	sb := strings.Builder{}
+	canImport := true
+	for _, rule := range sheet.Rules {
+		if !rule.Is("import") {
+			if !rule.Is("charset") && !(rule.Is("layer") && !rule.HasBlock) {
+				canImport = false
+			}
+			_, _ = sb.WriteString(css.Serialize(rule.Tokens()))
+			continue
+		}
+		imp, ok := parseImport(rule.Prelude)
+		if !canImport || !ok {
+			_, _ = sb.WriteString(css.Serialize(rule.Tokens()))
+			continue
+		}
+		link, err := resolveRef(sheetURL, imp.href)
+		if err != nil {
+			return "", err
+		}
+		_, _ = sb.WriteString(css.Serialize(rule.Leading))
+		if slices.Contains(stack, link) {
+			slog.Debug("Skip cyclic import", slog.String("href", link))
+			ctx.skip(link, "cyclic @import")
+			continue
+		}
+		// The stack holds the importing sheets, starting with the top one.
+		if len(stack) > opts.MaxImportDepth {
+			slog.Debug("Skip import exceeding depth limit", slog.String("href", link))
+			ctx.skip(link, fmt.Sprintf("@import depth exceeds %d", opts.MaxImportDepth))
+			continue
+		}
+		importURL, err := url.Parse(link)
+		if err != nil {
+			return "", fmt.Errorf("parse URL from %s: %w", link, err)
+		}
+		slog.Debug("Inline import", slog.String("href", link))
+		data, err := ctx.download(link, "text/css")
+		if err != nil {
+			return "", err
+		}
+		imported, err := inlineStylesheet(ctx, importURL, string(data), opts, append(slices.Clip(stack), link))
+		if err != nil {
+			return "", err
+		}
+		_, _ = sb.WriteString(imp.wrap(dropCharset(imported)))
+	}
+	_, _ = sb.WriteString(css.Serialize(sheet.Trailing))
+	return sb.String(), nil
+}
+
+func parseImport(prelude []css.Token) (*importRule, bool) {
+	tokens := css.Trim(prelude)
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	imp := &importRule{}
+	i := 0
+	switch token := tokens[0]; {
+	case token.Type == css.URL, token.Type == css.String:
+		imp.href = token.Value
+		i = 1
+	case token.Is(css.Function, "url"):
+		args, end := functionArgs(tokens, 0)
+		if len(args) != 1 || args[0].Type != css.String {
+			return nil, false
+		}
+		imp.href = args[0].Value
+		i = end + 1
+	default:
+		return nil, false
+	}
+	tokens = css.Trim(tokens[i:])
+	if len(tokens) > 0 && (tokens[0].Is(css.Ident, "layer") || tokens[0].Is(css.Function, "layer")) {
+		imp.hasLayer = true
+		end := 0
+		if tokens[0].Type == css.Function {
+			imp.layer, end = functionArgs(tokens, 0)
+		}
+		tokens = css.Trim(tokens[end+1:])
+	}
+	if len(tokens) > 0 && tokens[0].Is(css.Function, "supports") {
+		var end int
+		imp.supports, end = functionArgs(tokens, 0)
+		tokens = css.Trim(tokens[end+1:])
+	}
+	imp.media = tokens
+	return imp, true
+}
+
+// functionArgs returns the trimmed tokens between the parentheses of the
+// function at tokens[i] and the index of the closing parenthesis.
+func functionArgs(tokens []css.Token, i int) ([]css.Token, int) {
+	depth := 0
+	for j := i; j < len(tokens); j++ {
+		switch tokens[j].Type {
+		case css.Function, css.LeftParen:
+			depth++
+		case css.RightParen:
+			depth--
+			if depth == 0 {
+				return css.Trim(tokens[i+1 : j]), j
+			}
+		}
+	}
+	return css.Trim(tokens[i+1:]), len(tokens)
+}
+
+func (imp *importRule) wrap(style string) string {
+	if imp.hasLayer {
+		name := css.Serialize(imp.layer)
+		if len(name) > 0 {
+			name += " "
+		}
+		style = fmt.Sprintf("@layer %s{\n%s\n}", name, style)
+	}
+	if len(imp.supports) > 0 {
+		condition := css.Serialize(imp.supports)
+		if isSupportsDeclaration(imp.supports) {
+			condition = fmt.Sprintf("(%s)", condition)
+		}
+		style = fmt.Sprintf("@supports %s {\n%s\n}", condition, style)
+	}
+	if len(imp.media) > 0 {
+		style = fmt.Sprintf("@media %s {\n%s\n}", css.Serialize(imp.media), style)
+	}
+	return style
+}
+
+// isSupportsDeclaration reports whether the argument of supports() is a
+// bare declaration, which needs parentheses in an @supports rule.
+func isSupportsDeclaration(tokens []css.Token) bool {
+	if len(tokens) == 0 || tokens[0].Type != css.Ident {
+		return false
+	}
+	rest := css.Trim(tokens[1:])
+	return len(rest) > 0 && rest[0].Type == css.Colon
+}
+
+func dropCharset(style string) string {
+	sheet := css.Parse(style)
+	if len(sheet.Rules) > 0 && sheet.Rules[0].Is("charset") {
+		sheet.Rules = sheet.Rules[1:]
+	}
+	return sheet.String()
+}
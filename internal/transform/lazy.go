@@ -0,0 +1,193 @@
+package transform
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/css"
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+// DefaultLazyAttributes are the attributes lazy loading scripts keep the
+// real image URLs in. The ones ending in srcset hold a srcset.
+var DefaultLazyAttributes = []string{
+	"data-src", "data-lazy-src", "data-original", "data-srcset", "data-lazy-srcset",
+}
+
+// lazyClasses are the classes lazysizes replaces with lazyloaded once the
+// image is loaded, the styles of which often hide or blur the image.
+var lazyClasses = []string{"lazyload", "lazyloading"}
+
+type lazyResolver struct {
+	attrs        []string
+	promoted     int
+	unwrapped    int
+	eager        int
+	placeholders int
+}
+
+// ResolveLazyImages restores the images lazy loading scripts would load,
+// since scripts are removed: it promotes the URLs of the lazy attributes
+// to src and srcset, replaces script driven images with their noscript
+// fallbacks, removes loading=lazy and drops blurred placeholder styles.
+func ResolveLazyImages(opts ImageOptions) Transformer {
+	opts = opts.withDefaults()
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		r := &lazyResolver{attrs: opts.LazyAttributes}
+		noscripts := slices.Collect(node.FindAll(html.IsTag("noscript")))
+		for _, n := range noscripts {
+			if err := r.unwrap(n); err != nil {
+				return err
+			}
+		}
+		images := slices.Collect(node.FindAll(html.Or(html.IsTag("img"), html.IsTag("source"), html.IsTag("iframe"))))
+		for _, n := range images {
+			r.promote(n)
+			if loading, ok := n.GetAttr("loading"); ok && strings.EqualFold(loading, "lazy") {
+				n.DeleteAttr("loading")
+				r.eager++
+			}
+			r.removePlaceholder(n)
+		}
+		if r.promoted+r.unwrapped+r.eager+r.placeholders > 0 {
+			slog.Info(
+				"Resolve lazy images",
+				slog.Int("promoted", r.promoted),
+				slog.Int("unwrapped", r.unwrapped),
+				slog.Int("eager", r.eager),
+				slog.Int("placeholders", r.placeholders),
+			)
+		}
+		return nil
+	})
+}
+
+// unwrap replaces the noscript element with its content if it has an
+// image and follows a lazy image, which it is the fallback of, and removes
+// that lazy image. Other noscript elements, like tracking pixels, are kept.
+func (r *lazyResolver) unwrap(node *html.Node) error {
+	parent := node.Parent()
+	if parent == nil || !parent.IsElement() {
+		return nil
+	}
+	prev := node.PrevSibling()
+	for prev != nil && !prev.IsElement() && len(strings.TrimSpace(prev.Text())) == 0 {
+		prev = prev.PrevSibling()
+	}
+	if prev == nil || (prev.Tag() != "img" && prev.Tag() != "picture") || !r.isLazy(prev) {
+		return nil
+	}
+	nodes, err := html.ParseFragment(node.TextContent(), parent)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(nodes, func(n *html.Node) bool {
+		_, err := n.Find(html.IsTag("img"))
+		return err == nil
+	}) {
+		return nil
+	}
+	prev.Remove()
+	for _, n := range nodes {
+		node.InsertBefore(n)
+	}
+	node.Remove()
+	r.unwrapped++
+	return nil
+}
+
+// isLazy reports whether the image, or an image of the picture, is loaded
+// by a script.
+func (r *lazyResolver) isLazy(node *html.Node) bool {
+	for n := range node.FindAll(html.Or(html.IsTag("img"), html.IsTag("source"))) {
+		src, ok := n.GetAttr("src")
+		if slices.ContainsFunc(r.attrs, func(attr string) bool {
+			_, ok := n.GetAttr(attr)
+			return ok
+		}) || slices.ContainsFunc(lazyClasses, func(class string) bool {
+			return html.HasToken("class", class).Eval(n)
+		}) || (n.Tag() == "img" && (!ok || len(strings.TrimSpace(src)) == 0 || strings.HasPrefix(src, "data:"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// promote moves the URLs of the first lazy attribute of each kind to the
+// src and srcset attributes. Source elements of picture elements only
+// have a srcset.
+func (r *lazyResolver) promote(node *html.Node) {
+	promoted := false
+	done := make(map[string]bool)
+	for _, attr := range r.attrs {
+		value, ok := node.GetAttr(attr)
+		if !ok {
+			continue
+		}
+		node.DeleteAttr(attr)
+		target := "src"
+		if strings.HasSuffix(attr, "srcset") {
+			target = "srcset"
+		} else if parent := node.Parent(); node.Tag() == "source" && parent != nil && parent.Tag() == "picture" {
+			target = "srcset"
+		}
+		if value = strings.TrimSpace(value); len(value) == 0 || done[target] {
+			continue
+		}
+		slog.Debug("Promote lazy attribute", slog.String("attr", attr), slog.String("to", target))
+		node.DeleteAttr(target)
+		node.SetAttr(target, value)
+		done[target] = true
+		promoted = true
+	}
+	if sizes, ok := node.GetAttr("data-sizes"); ok {
+		node.DeleteAttr("data-sizes")
+		if !strings.EqualFold(strings.TrimSpace(sizes), "auto") {
+			node.DeleteAttr("sizes")
+			node.SetAttr("sizes", sizes)
+		}
+	}
+	if promoted {
+		r.promoted++
+	}
+}
+
+// removePlaceholder marks lazysizes images as loaded and removes the blur
+// filters of their style attributes.
+func (r *lazyResolver) removePlaceholder(node *html.Node) {
+	removed := false
+	if class, ok := node.GetAttr("class"); ok {
+		classes := strings.Fields(class)
+		if slices.ContainsFunc(classes, func(c string) bool { return slices.Contains(lazyClasses, c) }) {
+			classes = slices.DeleteFunc(classes, func(c string) bool {
+				return slices.Contains(lazyClasses, c) || c == "lazyloaded"
+			})
+			node.DeleteAttr("class")
+			node.SetAttr("class", strings.Join(append(classes, "lazyloaded"), " "))
+			removed = true
+		}
+	}
+	if style, ok := node.GetAttr("style"); ok {
+		declarations := css.ParseDeclarations(css.Tokenize(style))
+		kept := slices.DeleteFunc(slices.Clone(declarations), func(d *css.Declaration) bool {
+			return (d.Is("filter") || d.Is("-webkit-filter")) && slices.ContainsFunc(d.Value, func(t css.Token) bool {
+				return t.Is(css.Function, "blur")
+			})
+		})
+		if len(kept) < len(declarations) {
+			var sb strings.Builder
+			for _, d := range kept {
+				sb.WriteString(serializeDeclaration(d))
+			}
+			node.DeleteAttr("style")
+			if s := strings.TrimSpace(sb.String()); len(s) > 0 {
+				node.SetAttr("style", s)
+			}
+			removed = true
+		}
+	}
+	if removed {
+		r.placeholders++
+	}
+}
@@ -0,0 +1,39 @@
+package transform_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestResolveLazyImages(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body>
+<img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=" data-src="/a.png" data-srcset="/a.png 1x, /a2.png 2x" class="lazyload wide">
+<img class="js-lazy" src="/placeholder.png" data-original="/b.png" style="filter: blur(20px); width: 100%">
+<img src="/c.png" loading="lazy">
+<img class="lazyload" data-src="/d.png"><noscript><img src="/d.png" alt="d"></noscript>
+<noscript><p>Enable JavaScript</p></noscript>
+<p>text</p><noscript><img height="1" width="1" style="display:none" src="https://www.facebook.com/tr?id=1&amp;ev=PageView&amp;noscript=1"></noscript>
+</body></html>`,
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.ResolveLazyImages(transform.ImageOptions{})}
+	})
+	body, err := root.Find(html.IsTag("body"))
+	bee.Nil(err)
+	bee.Equal(strings.Join(strings.Fields(body.RenderString()), " "), strings.Join(strings.Fields(`<body>
+<img src="/a.png" srcset="/a.png 1x, /a2.png 2x" class="wide lazyloaded"/>
+<img class="js-lazy" src="/b.png" style="width: 100%;"/>
+<img src="/c.png"/>
+<img src="/d.png" alt="d"/>
+<noscript><p>Enable JavaScript</p></noscript>
+<p>text</p><noscript><img height="1" width="1" style="display:none" src="https://www.facebook.com/tr?id=1&amp;ev=PageView&amp;noscript=1"></noscript>
+</body>`), " "))
+}
@@ -0,0 +1,89 @@
+package transform
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+// hintRels are the link types which only tell the browser to fetch a
+// resource or to connect to a server ahead of time.
+var hintRels = []string{"preload", "prefetch", "modulepreload", "preconnect", "dns-prefetch", "prerender"}
+
+// fetchingRels are the link types the browser fetches the target of.
+var fetchingRels = []string{
+	"stylesheet", "icon", "apple-touch-icon", "apple-touch-icon-precomposed", "mask-icon", "manifest",
+}
+
+// preloadDestinations are the values of the as attribute of the hints whose
+// resources can be inlined into the archive.
+var preloadDestinations = []string{"style", "font", "image"}
+
+// PreloadLinks fetches the style, font and image resources of the preload
+// and prefetch links into the fetch cache, so the transformers inlining
+// them later do not download them again, and removes every resource hint.
+// Hints which fail to load are dropped, they are fetched again if used.
+func PreloadLinks() Transformer {
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		hints := slices.Collect(node.FindAll(html.And(html.IsTag("link"), isHint)))
+		for _, n := range hints {
+			n.Remove()
+			href, ok := n.GetAttr("href")
+			as, _ := n.GetAttr("as")
+			if !ok || !isNetworkRef(href) || !slices.Contains(preloadDestinations, strings.ToLower(as)) {
+				continue
+			}
+			if !html.HasToken("rel", "preload").Eval(n) && !html.HasToken("rel", "prefetch").Eval(n) {
+				continue
+			}
+			if _, err := ctx.fetch(href); err != nil {
+				slog.Debug("Preload failed", slog.String("href", href), slog.String("error", err.Error()))
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveLinks removes the links the browser would fetch from the network,
+// like resource hints and stylesheets or icons which were not inlined.
+// Links which only describe the document, like canonical, alternate or
+// license links, are kept.
+func RemoveLinks() Transformer {
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		links := slices.Collect(node.FindAll(html.And(html.IsTag("link"), isNetworkLink)))
+		for _, n := range links {
+			href, _ := n.GetAttr("href")
+			slog.Debug("Remove link", slog.String("href", href))
+			n.Remove()
+		}
+		return nil
+	})
+}
+
+var isHint = html.NodeFilterFunc(func(node *html.Node) bool {
+	return slices.ContainsFunc(hintRels, func(rel string) bool {
+		return html.HasToken("rel", rel).Eval(node)
+	})
+})
+
+var isNetworkLink = html.NodeFilterFunc(func(node *html.Node) bool {
+	if isHint.Eval(node) {
+		return true
+	}
+	href, ok := node.GetAttr("href")
+	if !ok || !isNetworkRef(href) {
+		return false
+	}
+	return slices.ContainsFunc(fetchingRels, func(rel string) bool {
+		return html.HasToken("rel", rel).Eval(node)
+	})
+})
+
+// isNetworkRef reports whether the reference points to a resource on the
+// network, as opposed to data: URLs and fragments.
+func isNetworkRef(ref string) bool {
+	ref = strings.TrimSpace(ref)
+	return len(ref) > 0 && !strings.HasPrefix(ref, "#") && !strings.HasPrefix(strings.ToLower(ref), "data:")
+}
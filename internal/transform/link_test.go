@@ -0,0 +1,62 @@
+package transform_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestLinks(t *testing.T) {
+	bee := bee.New(t)
+	files := map[string]string{
+		"/index.html": `<html><head>
+<link rel="canonical" href="/page">
+<link rel="alternate" type="application/rss+xml" href="/feed.xml">
+<link rel="license" href="/license">
+<link rel="preload" as="font" href="/font.woff2" crossorigin>
+<link rel="prefetch" as="image" href="/img.png">
+<link rel="modulepreload" href="/app.js">
+<link rel="preconnect" href="https://cdn.example.com">
+<link rel="icon" href="/favicon.png">
+<link rel="icon" href="data:image/png;base64,AA==">
+<link rel="stylesheet" href="/style.css">
+</head><body></body></html>`,
+		"/style.css":  `@font-face { font-family: Font; src: url(font.woff2) }`,
+		"/font.woff2": "font",
+		"/img.png":    "image",
+	}
+	requests := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(data))
+	}))
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{
+			transform.ResolveLinks(baseURL),
+			transform.PreloadLinks(),
+			transform.InlineStyles(baseURL, transform.StyleOptions{}),
+			transform.RemoveLinks(),
+		}
+	})
+	bee.Equal(requests, []string{"/index.html", "/font.woff2", "/img.png", "/style.css"})
+	rels := make([]string, 0)
+	for link := range root.FindAll(html.IsTag("link")) {
+		rel, _ := link.GetAttr("rel")
+		rels = append(rels, rel)
+	}
+	bee.Equal(rels, []string{"canonical", "alternate", "license", "icon"})
+	style, err := root.Find(html.IsTag("style"))
+	bee.Nil(err)
+	bee.Equal(normalizeCSS(style.Text()), `@font-face{font-family: Font;src: url("data:font/woff2;base64,Zm9udA==")}`)
+}
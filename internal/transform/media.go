@@ -0,0 +1,283 @@
+package transform
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/http"
+)
+
+// DefaultMaxMediaSize is the size in bytes of the largest media file
+// inlined by default.
+const DefaultMaxMediaSize = 10 << 20
+
+// unavailableClass is the class of the captions of the media which are not
+// archived.
+const unavailableClass = "htdl-media-unavailable"
+
+// phrasingTags are the elements which only allow phrasing content, inside
+// which captions are small elements instead of paragraphs.
+var phrasingTags = []string{
+	"a", "abbr", "b", "bdi", "bdo", "button", "cite", "code", "data", "dfn", "dt", "em",
+	"h1", "h2", "h3", "h4", "h5", "h6", "i", "kbd", "label", "legend", "mark", "p", "pre",
+	"q", "s", "samp", "small", "span", "strong", "sub", "summary", "sup", "time", "u", "var",
+}
+
+// posterAttrs are the attributes of video elements kept on the img elements
+// of their posters.
+var posterAttrs = []string{"id", "class", "style", "width", "height", "title"}
+
+type MediaPolicy int
+
+const (
+	// MediaLink keeps the media remote and adds a caption linking to it.
+	MediaLink MediaPolicy = iota
+	// MediaPoster replaces video elements with their poster image. Media
+	// without a poster is linked.
+	MediaPoster
+	// MediaInline inlines the media up to the size cap. Larger media is
+	// linked.
+	MediaInline
+)
+
+func (p MediaPolicy) String() string {
+	switch p {
+	case MediaPoster:
+		return "poster"
+	case MediaInline:
+		return "inline"
+	default:
+		return "link"
+	}
+}
+
+type MediaOptions struct {
+	// Video is the policy for video elements.
+	Video MediaPolicy
+	// Audio is the policy for audio elements, which have no posters.
+	Audio MediaPolicy
+	// MaxSize is the size in bytes of the largest media file inlined, it
+	// defaults to DefaultMaxMediaSize.
+	MaxSize int
+}
+
+func (o MediaOptions) withDefaults() MediaOptions {
+	if o.MaxSize <= 0 {
+		o.MaxSize = DefaultMaxMediaSize
+	}
+	return o
+}
+
+// InlineMedia handles the video and audio elements by the policy of their
+// kind. The text tracks of the kept elements and the posters of the linked
+// videos are always inlined.
+func InlineMedia(opts MediaOptions) Transformer {
+	opts = opts.withDefaults()
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		media := slices.Collect(node.FindAll(html.Or(html.IsTag("video"), html.IsTag("audio"))))
+		for _, n := range media {
+			policy := opts.Audio
+			if n.Tag() == "video" {
+				policy = opts.Video
+			}
+			if err := inlineMediaElement(n, ctx, policy, opts.MaxSize); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func inlineMediaElement(node *html.Node, ctx *TransformerContext, policy MediaPolicy, maxSize int) error {
+	link, sources := mediaSource(node)
+	if policy == MediaPoster && node.Tag() == "video" {
+		if _, ok := node.GetAttr("poster"); ok {
+			for _, source := range append(sources, link) {
+				if len(source) > 0 {
+					ctx.skip(source, "replaced with the poster")
+				}
+			}
+			replaceWithPoster(node, ctx)
+			return nil
+		}
+	}
+	if err := inlineTracks(node, ctx); err != nil {
+		return err
+	}
+	if policy == MediaInline && len(link) > 0 && !strings.HasPrefix(link, "data:") {
+		inlined, err := inlineMediaSource(node, ctx, link, maxSize)
+		if err != nil {
+			return err
+		}
+		if inlined {
+			for _, source := range sources {
+				ctx.skip(source, "not the selected media source")
+			}
+			inlinePoster(node, ctx)
+			return nil
+		}
+	}
+	inlinePoster(node, ctx)
+	if len(link) > 0 && !strings.HasPrefix(link, "data:") {
+		addUnavailableCaption(node, link)
+	}
+	return nil
+}
+
+// mediaSource returns the URL of the src attribute, or else of the first
+// source element, and the URLs of the other source elements.
+func mediaSource(node *html.Node) (string, []string) {
+	link, _ := node.GetAttr("src")
+	link = strings.TrimSpace(link)
+	others := make([]string, 0)
+	for _, child := range node.Children() {
+		if child.Tag() != "source" {
+			continue
+		}
+		src, ok := child.GetAttr("src")
+		if src = strings.TrimSpace(src); !ok || len(src) == 0 {
+			continue
+		}
+		if len(link) == 0 {
+			link = src
+		} else {
+			others = append(others, src)
+		}
+	}
+	return link, others
+}
+
+// inlineMediaSource replaces the sources of the element with the data URL
+// of the media, unless it is larger than the size cap, which is checked
+// before it is downloaded, or its type is unknown. It reports whether the
+// media was inlined.
+func inlineMediaSource(node *html.Node, ctx *TransformerContext, link string, maxSize int) (bool, error) {
+	resp, err := ctx.fetchLimited(link, maxSize)
+	if errors.Is(err, http.ErrTooLarge) || (err == nil && len(resp.Data) > maxSize) {
+		slog.Debug("Skip media larger than the size cap", slog.String("src", link))
+		ctx.skip(link, "larger than the media size cap")
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	mimeType, err := responseMIMEType(link, resp.ContentType, "video", "audio")
+	if err != nil {
+		slog.Debug("Skip media of unknown type", slog.String("src", link), slog.String("contentType", resp.ContentType))
+		ctx.skip(link, "unknown media type")
+		return false, nil
+	}
+	for _, child := range node.Children() {
+		if child.Tag() != "source" {
+			continue
+		}
+		if src, _ := child.GetAttr("src"); strings.TrimSpace(src) == link {
+			if typ, ok := child.GetAttr("type"); ok {
+				mimeType, _, _ = strings.Cut(typ, ";")
+			}
+		}
+		child.Remove()
+	}
+	data, err := ctx.download(link, mimeType)
+	if err != nil {
+		return false, err
+	}
+	slog.Debug("Inline media", slog.String("src", link))
+	node.DeleteAttr("src")
+	node.SetAttr("src", dataURL(strings.TrimSpace(mimeType), data))
+	return true, nil
+}
+
+// inlineTracks inlines the text tracks of the element, which are small.
+func inlineTracks(node *html.Node, ctx *TransformerContext) error {
+	for _, child := range node.Children() {
+		src, ok := child.GetAttr("src")
+		if child.Tag() != "track" || !ok || !isNetworkRef(src) {
+			continue
+		}
+		slog.Debug("Inline track", slog.String("src", src))
+		data, err := ctx.download(src, "text/vtt")
+		if err != nil {
+			return err
+		}
+		child.DeleteAttr("src")
+		child.SetAttr("src", dataURL("text/vtt", data))
+	}
+	return nil
+}
+
+// inlinePoster inlines the poster of the element. Like the media, a poster
+// which cannot be inlined is kept remote.
+func inlinePoster(node *html.Node, ctx *TransformerContext) {
+	poster, ok := node.GetAttr("poster")
+	if !ok || !isNetworkRef(poster) {
+		return
+	}
+	resp, err := ctx.fetch(poster)
+	if err != nil {
+		slog.Debug("Skip poster", slog.String("src", poster), slog.String("error", err.Error()))
+		ctx.skip(poster, "poster not available")
+		return
+	}
+	mimeType, err := responseMIMEType(poster, resp.ContentType, "image")
+	if err != nil {
+		slog.Debug("Skip poster", slog.String("src", poster), slog.String("error", err.Error()))
+		ctx.skip(poster, "unknown poster type")
+		return
+	}
+	data, err := ctx.download(poster, mimeType)
+	if err != nil {
+		slog.Debug("Skip poster", slog.String("src", poster), slog.String("error", err.Error()))
+		ctx.skip(poster, "poster not available")
+		return
+	}
+	slog.Debug("Inline poster", slog.String("src", poster))
+	node.DeleteAttr("poster")
+	node.SetAttr("poster", dataURL(mimeType, data))
+}
+
+// replaceWithPoster replaces the video element with an img element of its
+// poster.
+func replaceWithPoster(node *html.Node, ctx *TransformerContext) {
+	inlinePoster(node, ctx)
+	poster, _ := node.GetAttr("poster")
+	attrs := map[string]string{"src": poster, "alt": ""}
+	for _, name := range posterAttrs {
+		if v, ok := node.GetAttr(name); ok {
+			attrs[name] = v
+		}
+	}
+	if label, ok := node.GetAttr("aria-label"); ok {
+		attrs["alt"] = label
+	}
+	node.ReplaceWith(html.NewNode("img", attrs, ""))
+}
+
+// addUnavailableCaption adds a caption linking to the media after the
+// element. Inside phrasing content the caption is a small element, and
+// inside links and buttons, which cannot hold links, it has no link.
+func addUnavailableCaption(node *html.Node, link string) {
+	tag, interactive := "p", false
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if slices.Contains(phrasingTags, parent.Tag()) {
+			tag = "small"
+		}
+		if parent.Tag() == "a" || parent.Tag() == "button" {
+			interactive = true
+		}
+	}
+	caption := html.NewNode(tag, map[string]string{"class": unavailableClass}, "Unavailable offline: ")
+	if interactive {
+		caption.SetText("Unavailable offline: " + link)
+	} else {
+		caption.AppendChild(html.NewNode("a", map[string]string{"href": link}, link))
+	}
+	if next := node.NextSibling(); next != nil {
+		next.InsertBefore(caption)
+	} else if parent := node.Parent(); parent != nil {
+		parent.AppendChild(caption)
+	}
+}
@@ -0,0 +1,125 @@
+package transform_test
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestInlineMedia(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body><video poster="poster.png" class="clip"><source src="a.webm" type="video/webm"><source src="a.mp4"><track src="en.vtt" srclang="en"></video><audio src="/big.mp3"></audio></body></html>`,
+		"/poster.png": "poster",
+		"/a.webm":     "webm",
+		"/a.mp4":      "mp4",
+		"/en.vtt":     "WEBVTT",
+		"/big.mp3":    "0123456789",
+	})
+	defer srv.Close()
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	poster := imageDataURL("png", "poster")
+	track := `<track srclang="en" src="data:text/vtt;base64,` + b64("WEBVTT") + `"/>`
+	tests := []struct {
+		opts     transform.MediaOptions
+		expected string
+	}{
+		{
+			transform.MediaOptions{},
+			`<video class="clip" poster="` + poster + `"><source type="video/webm" src="` + srv.URL + `/a.webm"/>` +
+				`<source src="` + srv.URL + `/a.mp4"/>` + track + `</video>` +
+				`<p class="htdl-media-unavailable">Unavailable offline: <a href="` + srv.URL + `/a.webm">` + srv.URL + `/a.webm</a></p>` +
+				`<audio src="` + srv.URL + `/big.mp3"></audio>` +
+				`<p class="htdl-media-unavailable">Unavailable offline: <a href="` + srv.URL + `/big.mp3">` + srv.URL + `/big.mp3</a></p>`,
+		},
+		{
+			transform.MediaOptions{Video: transform.MediaPoster, Audio: transform.MediaInline},
+			`<img alt="" class="clip" src="` + poster + `"/><audio src="data:audio/mpeg;base64,` + b64("0123456789") + `"></audio>`,
+		},
+		{
+			transform.MediaOptions{Video: transform.MediaInline, Audio: transform.MediaInline, MaxSize: 8},
+			`<video class="clip" src="data:video/webm;base64,` + b64("webm") + `" poster="` + poster + `">` + track + `</video>` +
+				`<audio src="` + srv.URL + `/big.mp3"></audio>` +
+				`<p class="htdl-media-unavailable">Unavailable offline: <a href="` + srv.URL + `/big.mp3">` + srv.URL + `/big.mp3</a></p>`,
+		},
+	}
+	for _, test := range tests {
+		root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+			return []transform.Transformer{transform.ResolveLinks(baseURL), transform.InlineMedia(test.opts)}
+		})
+		body, err := root.Find(html.IsTag("body"))
+		bee.Nil(err)
+		bee.Equal(strings.TrimSuffix(strings.TrimPrefix(body.RenderString(), "<body>"), "</body>"), test.expected)
+	}
+}
+
+func TestInlineMediaContentType(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body><audio src="/stream?id=1"></audio><video src="/clip"></video></body></html>`,
+		"/stream":     "ID3audio",
+		"/clip":       "not a video",
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{
+			transform.ResolveLinks(baseURL),
+			transform.InlineMedia(transform.MediaOptions{Video: transform.MediaInline, Audio: transform.MediaInline}),
+		}
+	})
+	body, err := root.Find(html.IsTag("body"))
+	bee.Nil(err)
+	bee.Equal(
+		strings.TrimSuffix(strings.TrimPrefix(body.RenderString(), "<body>"), "</body>"),
+		`<audio src="data:audio/mpeg;base64,`+base64.StdEncoding.EncodeToString([]byte("ID3audio"))+`"></audio>`+
+			`<video src="`+srv.URL+`/clip"></video>`+
+			`<p class="htdl-media-unavailable">Unavailable offline: <a href="`+srv.URL+`/clip">`+srv.URL+`/clip</a></p>`,
+	)
+}
+
+func TestInlineMediaPosters(t *testing.T) {
+	bee := bee.New(t)
+	poster := "\x89PNG\r\n\x1a\nposter"
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body><video poster="/poster?id=1"></video><video poster="/missing.png"></video></body></html>`,
+		"/poster":     poster,
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.ResolveLinks(baseURL), transform.InlineMedia(transform.MediaOptions{})}
+	})
+	body, err := root.Find(html.IsTag("body"))
+	bee.Nil(err)
+	bee.Equal(
+		strings.TrimSuffix(strings.TrimPrefix(body.RenderString(), "<body>"), "</body>"),
+		`<video poster="`+imageDataURL("png", poster)+`"></video><video poster="`+srv.URL+`/missing.png"></video>`,
+	)
+}
+
+func TestInlineMediaCaptions(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body><div><audio src="/a.mp3"></audio></div><p><audio src="/b.mp3"></audio></p>` +
+			`<a href="/c"><video src="/c.mp4"></video></a></body></html>`,
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.ResolveLinks(baseURL), transform.InlineMedia(transform.MediaOptions{})}
+	})
+	body, err := root.Find(html.IsTag("body"))
+	bee.Nil(err)
+	bee.Equal(
+		strings.TrimSuffix(strings.TrimPrefix(body.RenderString(), "<body>"), "</body>"),
+		`<div><audio src="`+srv.URL+`/a.mp3"></audio>`+
+			`<p class="htdl-media-unavailable">Unavailable offline: <a href="`+srv.URL+`/a.mp3">`+srv.URL+`/a.mp3</a></p></div>`+
+			`<p><audio src="`+srv.URL+`/b.mp3"></audio>`+
+			`<small class="htdl-media-unavailable">Unavailable offline: <a href="`+srv.URL+`/b.mp3">`+srv.URL+`/b.mp3</a></small></p>`+
+			`<a href="`+srv.URL+`/c"><video src="`+srv.URL+`/c.mp4"></video>`+
+			`<small class="htdl-media-unavailable">Unavailable offline: `+srv.URL+`/c.mp4</small></a>`,
+	)
+}
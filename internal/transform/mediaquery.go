@@ -0,0 +1,172 @@
+package transform
+
+import (
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/css"
+)
+
+// viewportWidth is the width in pixels of the viewport media queries and
+// the sizes attribute are evaluated against.
+const viewportWidth = 1280
+
+// fontSize is the size in pixels of the em and rem units in the sizes
+// attribute.
+const fontSize = 16
+
+// evalMediaQuery evaluates a media query list for a screen with the
+// viewport width.
+func evalMediaQuery(query string) bool {
+	for _, q := range css.SplitCommas(css.Tokenize(query)) {
+		q = css.Trim(q)
+		if len(q) == 0 {
+			continue
+		}
+		negate := false
+		if q[0].Is(css.Ident, "not") || q[0].Is(css.Ident, "only") {
+			negate = q[0].Is(css.Ident, "not")
+			q = css.Trim(q[1:])
+		}
+		if len(q) > 0 && q[0].Type == css.Ident {
+			screen := q[0].Is(css.Ident, "all") || q[0].Is(css.Ident, "screen")
+			q = css.Trim(q[1:])
+			if len(q) > 0 && q[0].Is(css.Ident, "and") {
+				q = q[1:]
+			} else if len(q) > 0 {
+				continue
+			}
+			if matches := screen && (len(q) == 0 || evalMediaCondition(q)); matches != negate {
+				return true
+			}
+			continue
+		}
+		if evalMediaCondition(q) != negate {
+			return true
+		}
+	}
+	return false
+}
+
+// evalLength returns the length in pixels, for the units which do not
+// depend on the layout.
+func evalLength(token css.Token) (float64, bool) {
+	switch token.Type {
+	case css.Number:
+		return 0, token.Number == 0
+	case css.Dimension:
+		switch strings.ToLower(token.Unit) {
+		case "px":
+			return token.Number, true
+		case "vw":
+			return token.Number * viewportWidth / 100, true
+		case "em", "rem":
+			return token.Number * fontSize, true
+		}
+	}
+	return 0, false
+}
+
+// evalMediaCondition evaluates the width features of a media condition,
+// combined with and, or and not. Other features never match.
+func evalMediaCondition(tokens []css.Token) bool {
+	tokens = css.Trim(tokens)
+	if len(tokens) > 0 && tokens[0].Is(css.Ident, "not") {
+		return !evalMediaCondition(tokens[1:])
+	}
+	result, op := false, ""
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch {
+		case token.Type == css.Whitespace || token.Type == css.Comment:
+		case token.Is(css.Ident, "and") || token.Is(css.Ident, "or"):
+			op = strings.ToLower(token.Value)
+		case token.Type == css.LeftParen:
+			end := i + 1
+			for depth := 1; end < len(tokens) && depth > 0; end++ {
+				switch tokens[end].Type {
+				case css.LeftParen, css.Function:
+					depth++
+				case css.RightParen:
+					depth--
+				}
+			}
+			inner := tokens[i+1 : max(end-1, i+1)]
+			var value bool
+			if feature, ok := evalWidthFeature(inner); ok {
+				value = feature
+			} else {
+				value = evalMediaCondition(inner)
+			}
+			switch op {
+			case "and":
+				result = result && value
+			case "or":
+				result = result || value
+			default:
+				result = value
+			}
+			i = end - 1
+		default:
+			return false
+		}
+	}
+	return result
+}
+
+// evalWidthFeature evaluates a min-width, max-width or width feature, or a
+// range of the width. It reports false if the tokens are not one.
+func evalWidthFeature(tokens []css.Token) (bool, bool) {
+	parts := make([]css.Token, 0, 3)
+	for _, token := range tokens {
+		if token.Type != css.Whitespace && token.Type != css.Comment {
+			parts = append(parts, token)
+		}
+	}
+	if len(parts) == 3 && parts[0].Type == css.Ident && parts[1].Type == css.Colon {
+		length, ok := evalLength(parts[2])
+		if !ok {
+			return false, false
+		}
+		switch strings.ToLower(parts[0].Value) {
+		case "min-width":
+			return viewportWidth >= length, true
+		case "max-width":
+			return viewportWidth <= length, true
+		case "width":
+			return viewportWidth == length, true
+		}
+		return false, false
+	}
+	op := ""
+	var length css.Token
+	for _, token := range parts {
+		switch {
+		case token.Is(css.Ident, "width"):
+		case token.Type == css.Delim:
+			op += token.Value
+		default:
+			length = token
+		}
+	}
+	value, ok := evalLength(length)
+	if !ok || len(parts) < 3 || len(parts) > 4 {
+		return false, false
+	}
+	if !parts[0].Is(css.Ident, "width") {
+		// The length is on the left, so flip the comparison.
+		op = strings.NewReplacer("<", ">", ">", "<").Replace(op)
+	}
+	switch op {
+	case "<":
+		return viewportWidth < value, true
+	case "<=":
+		return viewportWidth <= value, true
+	case ">":
+		return viewportWidth > value, true
+	case ">=":
+		return viewportWidth >= value, true
+	case "=":
+		return viewportWidth == value, true
+	}
+	return false, false
+}
@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+// metaImageProperties are the Open Graph and Twitter card properties of the
+// meta elements describing the image of the page.
+var metaImageProperties = []string{"og:image", "og:image:url", "og:image:secure_url", "twitter:image", "twitter:image:src"}
+
+// InlineMetaImages replaces the URLs of the images describing the page in
+// the Open Graph and Twitter card meta elements, the schema.org image
+// microdata and the image_src links with data URLs, so previews of the
+// archive keep their thumbnails. The images are optimized like the img
+// elements. Images which fail to load are kept as absolute URLs.
+func InlineMetaImages(baseURL *url.URL, opts ImageOptions) Transformer {
+	opts = opts.withDefaults()
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		docURL := documentBaseURL(node, baseURL)
+		metas := slices.Collect(node.FindAll(html.IsTag("meta"), html.NodeFilterFunc(isMetaImage)))
+		for _, n := range metas {
+			if err := inlineMetaImage(n, "content", docURL, ctx, opts); err != nil {
+				return err
+			}
+		}
+		links := slices.Collect(node.FindAll(html.IsTag("link"), html.Or(html.HasToken("rel", "image_src"), html.HasToken("itemprop", "image"))))
+		for _, n := range links {
+			if err := inlineMetaImage(n, "href", docURL, ctx, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func isMetaImage(node *html.Node) bool {
+	if html.HasToken("itemprop", "image").Eval(node) {
+		return true
+	}
+	for _, attr := range []string{"property", "name"} {
+		if v, ok := node.GetAttr(attr); ok && slices.Contains(metaImageProperties, strings.ToLower(strings.TrimSpace(v))) {
+			return true
+		}
+	}
+	return false
+}
+
+func inlineMetaImage(node *html.Node, attr string, docURL *url.URL, ctx *TransformerContext, opts ImageOptions) error {
+	v, _ := node.GetAttr(attr)
+	if !isNetworkRef(v) {
+		return nil
+	}
+	link, err := resolveRef(docURL, strings.TrimSpace(v))
+	if err != nil {
+		return err
+	}
+	node.ReplaceAttr(attr, link)
+	resp, err := ctx.fetch(link)
+	if err != nil {
+		slog.Debug("Skip meta image", slog.String("src", link), slog.String("error", err.Error()))
+		return nil
+	}
+	mimeType, err := fetchedImageMIMEType(link, resp.ContentType)
+	if err != nil {
+		slog.Debug("Skip meta image", slog.String("src", link), slog.String("error", err.Error()))
+		return nil
+	}
+	data, err := ctx.download(link, mimeType)
+	if err != nil {
+		return err
+	}
+	slog.Debug("Inline meta image", slog.String("src", link))
+	optimized, optimizedType := optimizeImage(data, mimeType, opts)
+	if saved := len(data) - len(optimized); saved > 0 {
+		ctx.save(saved)
+	}
+	node.ReplaceAttr(attr, dataURL(optimizedType, optimized))
+	return nil
+}
+
+// fetchedImageMIMEType returns the MIME type of the image by its extension,
+// or by the content type of the response if its extension is not an image
+// one, as social images and thumbnails are often generated on request.
+func fetchedImageMIMEType(link string, contentType string) (string, error) {
+	return responseMIMEType(link, contentType, "image")
+}
@@ -0,0 +1,50 @@
+package transform_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestInlineMetaImages(t *testing.T) {
+	bee := bee.New(t)
+	files := map[string]string{
+		"/index.html": `<html><head><base href="/static/">` +
+			`<meta property="og:image" content="social.png"><meta name="twitter:image" content="/og.php?title=page">` +
+			`<meta property="og:title" content="title.png"><meta itemprop="image" content="/missing.png">` +
+			`<link rel="image_src" href="social.png"></head><body></body></html>`,
+		"/static/social.png": "social",
+		"/og.php":            "generated",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/og.php" {
+			w.Header().Set("Content-Type", "image/jpeg; charset=binary")
+		}
+		_, _ = w.Write([]byte(data))
+	}))
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.InlineMetaImages(baseURL, transform.ImageOptions{})}
+	})
+	head, err := root.Find(html.IsTag("head"))
+	bee.Nil(err)
+	social := imageDataURL("png", "social")
+	expected := `<head><base href="/static/">` +
+		`<meta property="og:image" content="` + social + `"/>` +
+		`<meta name="twitter:image" content="` + imageDataURL("jpeg", "generated") + `"/>` +
+		`<meta property="og:title" content="title.png"/>` +
+		`<meta itemprop="image" content="` + srv.URL + `/missing.png"/>` +
+		`<link rel="image_src" href="` + social + `"/></head>`
+	bee.Equal(strings.ReplaceAll(head.RenderString(), `<base href="/static/"/>`, `<base href="/static/">`), expected)
+}
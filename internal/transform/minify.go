@@ -0,0 +1,42 @@
+package transform
+
+import (
+	"log/slog"
+	"slices"
+
+	"github.com/danielrenes/htdl/internal/css"
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+// MinifyStyles minifies the style elements. An @font-face rule starting an
+// unconditional style element is dropped if it repeats the last rule of the
+// previous one, since font faces apply to the whole document. Duplicates
+// after other rules are kept, as they could decide which face wins.
+func MinifyStyles() Transformer {
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		last := ""
+		styleNodes := slices.Collect(node.FindAll(html.IsTag("style")))
+		for _, n := range styleNodes {
+			before := len(n.Text())
+			style := css.Minify(n.Text())
+			if media, ok := n.GetAttr("media"); !ok || media == "all" {
+				sheet := css.Parse(style)
+				sheet.Rules = slices.DeleteFunc(sheet.Rules, func(rule *css.Rule) bool {
+					key := css.Serialize(rule.Tokens())
+					if rule.Is("font-face") && key == last {
+						return true
+					}
+					last = key
+					return false
+				})
+				style = sheet.String()
+			} else {
+				last = ""
+			}
+			n.SetText(style)
+			slog.Debug("Minify style", slog.Int("before", before), slog.Int("after", len(style)))
+			ctx.save(before - len(style))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,191 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"math"
+)
+
+// DefaultJPEGQuality is the quality downscaled JPEG images are encoded with
+// if no quality is set.
+const DefaultJPEGQuality = 85
+
+// maxImagePixels limits the size of the images which are decoded, since a
+// small file can declare dimensions which need gigabytes of memory.
+const maxImagePixels = 50_000_000
+
+// optimizeImage downscales the PNG, JPEG and single frame GIF images wider
+// than the maximum width and re-encodes the JPEG images with the quality.
+// Downscaled GIF images are encoded as PNG. It returns the original image
+// if it cannot be decoded, it is too large, it has an orientation or a
+// color profile which encoding would drop, or the result would not be
+// smaller.
+func optimizeImage(data []byte, mimeType string, opts ImageOptions) ([]byte, string) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return data, mimeType
+	}
+	if config.Width*config.Height > maxImagePixels {
+		slog.Debug("Keep large image", slog.Int("width", config.Width), slog.Int("height", config.Height))
+		return data, mimeType
+	}
+	if hasImageMetadata(data, format) {
+		slog.Debug("Keep image with orientation or color profile", slog.String("format", format))
+		return data, mimeType
+	}
+	resize := opts.MaxWidth > 0 && config.Width > opts.MaxWidth
+	if !resize && (format != "jpeg" || opts.JPEGQuality <= 0) {
+		return data, mimeType
+	}
+	if format == "gif" {
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(anim.Image) > 1 {
+			return data, mimeType
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return data, mimeType
+	}
+	if resize {
+		img = downscale(img, opts.MaxWidth)
+	}
+	buf := &bytes.Buffer{}
+	optimizedType := "image/png"
+	if format == "jpeg" {
+		quality := opts.JPEGQuality
+		if quality <= 0 {
+			quality = DefaultJPEGQuality
+		}
+		optimizedType = "image/jpeg"
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(buf, img)
+	}
+	if err != nil || buf.Len() >= len(data) {
+		slog.Debug("Keep original image", slog.Int("size", len(data)))
+		return data, mimeType
+	}
+	slog.Debug(
+		"Optimize image",
+		slog.Int("width", config.Width),
+		slog.Int("newWidth", img.Bounds().Dx()),
+		slog.Int("size", len(data)),
+		slog.Int("newSize", buf.Len()),
+	)
+	return buf.Bytes(), optimizedType
+}
+
+// hasImageMetadata reports whether the JPEG image has an EXIF orientation
+// or an ICC profile, or the PNG image has an ICC profile, which the
+// encoders do not write.
+func hasImageMetadata(data []byte, format string) bool {
+	switch format {
+	case "jpeg":
+		for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+			marker := data[i+1]
+			if marker == 0xda || marker == 0xd9 {
+				break
+			}
+			if marker == 0xff || marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+				i += 2
+				continue
+			}
+			end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+			if end > len(data) {
+				break
+			}
+			segment := data[i+4 : end]
+			switch {
+			case marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+				if exifOrientation(segment[6:]) > 1 {
+					return true
+				}
+			case marker == 0xe2 && bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00")):
+				return true
+			}
+			i = end
+		}
+	case "png":
+		for i := 8; i+8 <= len(data); {
+			typ := string(data[i+4 : i+8])
+			if typ == "iCCP" {
+				return true
+			}
+			if typ == "IDAT" {
+				break
+			}
+			i += 12 + int(binary.BigEndian.Uint32(data[i:]))
+		}
+	}
+	return false
+}
+
+// exifOrientation returns the orientation tag of the first image file
+// directory of the TIFF structure of an EXIF segment, or 0 if it has none.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := range entries {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// downscale resizes the image to the width keeping its aspect ratio, each
+// pixel is the average of the pixels of the source it covers.
+func downscale(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	height := max(1, int(math.Round(float64(bounds.Dy())*float64(width)/float64(bounds.Dx()))))
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := range width {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r / n) >> 8),
+				G: uint8((g / n) >> 8),
+				B: uint8((b / n) >> 8),
+				A: uint8((a / n) >> 8),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,116 @@
+package transform_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestOptimizeImages(t *testing.T) {
+	bee := bee.New(t)
+	photo := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := range 200 {
+		for x := range 400 {
+			photo.SetRGBA(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x ^ y), A: 255})
+		}
+	}
+	jpegData := &bytes.Buffer{}
+	bee.Nil(jpeg.Encode(jpegData, photo, &jpeg.Options{Quality: 100}))
+	pngData := &bytes.Buffer{}
+	bee.Nil(png.Encode(pngData, photo))
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" width="4000" height="10"></svg>`
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body><img id="jpg" src="/a.jpg"><img id="png" src="/a.png"><img id="svg" src="/a.svg"></body></html>`,
+		"/a.jpg":      jpegData.String(),
+		"/a.png":      pngData.String(),
+		"/a.svg":      svg,
+	})
+	defer srv.Close()
+	tests := []struct {
+		opts   transform.ImageOptions
+		width  int
+		height int
+	}{
+		{transform.ImageOptions{MaxWidth: 100}, 100, 50},
+		{transform.ImageOptions{MaxWidth: 1000, JPEGQuality: 50}, 400, 200},
+	}
+	for _, test := range tests {
+		root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+			return []transform.Transformer{transform.ResolveLinks(baseURL), transform.InlineImages(test.opts)}
+		})
+		jpg := decodeImage(bee, root, "jpg")
+		bee.Equal(len(jpg) < jpegData.Len(), true)
+		config, format, err := image.DecodeConfig(bytes.NewReader(jpg))
+		bee.Nil(err)
+		bee.Equal(format, "jpeg")
+		bee.Equal([]int{config.Width, config.Height}, []int{test.width, test.height})
+		config, _, err = image.DecodeConfig(bytes.NewReader(decodeImage(bee, root, "png")))
+		bee.Nil(err)
+		bee.Equal(config.Width, min(test.width, test.opts.MaxWidth))
+		bee.Equal(string(decodeImage(bee, root, "svg")), svg)
+	}
+}
+
+func TestOptimizeImagesKeepOriginal(t *testing.T) {
+	bee := bee.New(t)
+	photo := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	jpegData := &bytes.Buffer{}
+	bee.Nil(jpeg.Encode(jpegData, photo, &jpeg.Options{Quality: 100}))
+	// An EXIF segment with a big endian TIFF structure, the only entry of
+	// which is the orientation 6, rotated by 90 degrees.
+	exif := append([]byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01"), 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, 0x06, 0x00, 0x00)
+	rotated := jpegWithSegment(jpegData.Bytes(), 0xe1, exif)
+	profiled := jpegWithSegment(jpegData.Bytes(), 0xe2, []byte("ICC_PROFILE\x00\x01\x01profile"))
+	pngData := &bytes.Buffer{}
+	bee.Nil(png.Encode(pngData, image.NewRGBA(image.Rect(0, 0, 1, 1))))
+	// The header declares an image of 100000x100000 pixels.
+	bomb := slices.Clone(pngData.Bytes())
+	binary.BigEndian.PutUint32(bomb[16:], 100000)
+	binary.BigEndian.PutUint32(bomb[20:], 100000)
+	binary.BigEndian.PutUint32(bomb[29:], crc32.ChecksumIEEE(bomb[12:29]))
+	srv := newServer(map[string]string{
+		"/index.html":   `<html><body><img id="rotated" src="/rotated.jpg"><img id="profiled" src="/profiled.jpg"><img id="bomb" src="/bomb.png"></body></html>`,
+		"/rotated.jpg":  string(rotated),
+		"/profiled.jpg": string(profiled),
+		"/bomb.png":     string(bomb),
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.ResolveLinks(baseURL), transform.InlineImages(transform.ImageOptions{MaxWidth: 100})}
+	})
+	bee.Equal(decodeImage(bee, root, "rotated"), rotated)
+	bee.Equal(decodeImage(bee, root, "profiled"), profiled)
+	bee.Equal(decodeImage(bee, root, "bomb"), bomb)
+}
+
+// jpegWithSegment inserts an application segment after the start of image
+// marker of the JPEG image.
+func jpegWithSegment(data []byte, marker byte, payload []byte) []byte {
+	segment := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return slices.Concat(data[:2], segment, payload, data[2:])
+}
+
+func decodeImage(bee *bee.Bee, root *html.Node, id string) []byte {
+	img, err := root.Find(html.HasAttr("id", id))
+	bee.Nil(err)
+	src, _ := img.GetAttr("src")
+	_, b64, ok := strings.Cut(src, ";base64,")
+	bee.True(ok)
+	data, err := base64.StdEncoding.DecodeString(b64)
+	bee.Nil(err)
+	return data
+}
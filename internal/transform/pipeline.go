@@ -15,8 +15,16 @@ func NewPipeline(transformers ...Transformer) *Pipeline {
 	return &Pipeline{ctx: NewTransformerContext(), transformers: transformers}
 }
 
+func (p *Pipeline) Context() *TransformerContext {
+	return p.ctx
+}
+
 func (p *Pipeline) Run(node *html.Node) error {
 	for _, transformer := range p.transformers {
+		p.ctx.transformer = ""
+		if named, ok := transformer.(*namedTransformer); ok {
+			p.ctx.transformer = named.name
+		}
 		if err := transformer.Transform(node, p.ctx); err != nil {
 			switch transformer := transformer.(type) {
 			case *namedTransformer:
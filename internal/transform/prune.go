@@ -0,0 +1,224 @@
+package transform
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/css"
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+type PruneMode int
+
+const (
+	PruneNone PruneMode = iota
+	// PruneConservative keeps the rules whose selectors could match after
+	// user interaction or scripting, it assumes that state dependent
+	// pseudo-classes and attribute selectors match.
+	PruneConservative
+	// PruneStrict matches selectors against the document as it is
+	// archived, where no element is hovered or focused.
+	PruneStrict
+)
+
+func (m PruneMode) String() string {
+	switch m {
+	case PruneConservative:
+		return "conservative"
+	case PruneStrict:
+		return "strict"
+	default:
+		return "none"
+	}
+}
+
+// groupRules are the conditional group rules whose blocks hold style
+// rules.
+var groupRules = []string{"media", "supports", "container", "layer", "document", "-moz-document", "scope", "starting-style"}
+
+var keyframesRules = []string{"keyframes", "-webkit-keyframes", "-moz-keyframes", "-o-keyframes"}
+
+type pruner struct {
+	elements   []*html.Node
+	opts       css.MatchOptions
+	fonts      map[string]bool
+	animations map[string]bool
+}
+
+// PruneStyles removes the style rules of the style elements whose
+// selectors match no element of the document, and the @keyframes and
+// @font-face rules which the remaining rules and the style attributes do
+// not reference. Rules with selectors it cannot parse are kept.
+func PruneStyles(mode PruneMode) Transformer {
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		if mode == PruneNone {
+			return nil
+		}
+		p := &pruner{
+			elements:   slices.Collect(node.FindAll(html.NodeFilterFunc((*html.Node).IsElement))),
+			opts:       css.MatchOptions{AssumeState: mode == PruneConservative},
+			fonts:      make(map[string]bool),
+			animations: make(map[string]bool),
+		}
+		for _, n := range p.elements {
+			if style, ok := n.GetAttr("style"); ok {
+				p.collect(css.Tokenize(style))
+			}
+			for _, name := range []string{"font-family", "face"} {
+				if family, ok := n.GetAttr(name); ok {
+					collectFonts(css.Tokenize(family), p.fonts)
+				}
+			}
+		}
+		styleNodes := slices.Collect(node.FindAll(html.IsTag("style")))
+		sheets := make([]*css.Stylesheet, len(styleNodes))
+		for i, n := range styleNodes {
+			sheets[i] = css.Parse(n.Text())
+			sheets[i].Rules = p.pruneStyleRules(sheets[i].Rules)
+		}
+		for i, n := range styleNodes {
+			sheets[i].Rules = p.pruneAtRules(sheets[i].Rules)
+			before := len(n.Text())
+			n.SetText(sheets[i].String())
+			slog.Debug("Prune style", slog.Int("before", before), slog.Int("after", len(n.Text())))
+			ctx.save(before - len(n.Text()))
+		}
+		return nil
+	})
+}
+
+// pruneStyleRules drops the style rules matching no element and collects
+// the fonts and animations the kept rules reference.
+func (p *pruner) pruneStyleRules(rules []*css.Rule) []*css.Rule {
+	return pruneRules(rules, func(rule *css.Rule) bool {
+		if len(rule.AtKeyword) > 0 {
+			if !rule.Is("font-face") {
+				p.collect(rule.Block)
+			}
+			return true
+		}
+		selectors, err := css.ParseSelectors(rule.Prelude)
+		if err == nil && !slices.ContainsFunc(p.elements, func(n *html.Node) bool {
+			return selectors.Matches(n, p.opts)
+		}) {
+			return false
+		}
+		p.collect(rule.Block)
+		return true
+	})
+}
+
+// pruneAtRules drops the @keyframes and @font-face rules nothing
+// references.
+func (p *pruner) pruneAtRules(rules []*css.Rule) []*css.Rule {
+	return pruneRules(rules, func(rule *css.Rule) bool {
+		switch {
+		case slices.ContainsFunc(keyframesRules, rule.Is):
+			name := css.Trim(rule.Prelude)
+			return len(name) != 1 || p.animations[name[0].Value]
+		case rule.Is("font-face"):
+			for _, d := range css.ParseDeclarations(rule.Block) {
+				if d.Is("font-family") {
+					return p.fonts[familyName(d.Value)]
+				}
+			}
+		}
+		return true
+	})
+}
+
+// pruneRules returns the rules for which keep returns true, descending
+// into conditional group rules, which are dropped once they are empty.
+func pruneRules(rules []*css.Rule, keep func(rule *css.Rule) bool) []*css.Rule {
+	kept := make([]*css.Rule, 0, len(rules))
+	for _, rule := range rules {
+		if !rule.HasBlock || !slices.ContainsFunc(groupRules, rule.Is) {
+			if keep(rule) {
+				kept = append(kept, rule)
+			}
+			continue
+		}
+		block := css.ParseRules(rule.Block)
+		block.Rules = pruneRules(block.Rules, keep)
+		if len(block.Rules) == 0 {
+			if !rule.Is("layer") || len(css.Trim(rule.Prelude)) == 0 {
+				continue
+			}
+			// A named layer keeps its position in the layer order.
+			rule.Prelude = css.Trim(rule.Prelude)
+			rule.Prelude = append([]css.Token{{Type: css.Whitespace, Value: " ", Raw: " "}}, rule.Prelude...)
+			rule.HasBlock = false
+			rule.Block = nil
+		} else {
+			rule.Block = block.Tokens()
+		}
+		kept = append(kept, rule)
+	}
+	return kept
+}
+
+// collect records the fonts and animations the declarations of the block
+// and of its nested rules reference. Custom properties may hold either, so
+// their values are recorded as both.
+func (p *pruner) collect(block []css.Token) {
+	for _, rule := range css.ParseNestedRules(block) {
+		if rule.HasBlock && !rule.Is("font-face") {
+			p.collect(rule.Block)
+		}
+	}
+	for _, d := range css.ParseDeclarations(block) {
+		custom := strings.HasPrefix(d.Name, "--")
+		if custom || d.Is("font") || d.Is("font-family") {
+			collectFonts(d.Value, p.fonts)
+		}
+		if custom || d.Is("animation") || d.Is("animation-name") ||
+			d.Is("-webkit-animation") || d.Is("-webkit-animation-name") {
+			for _, token := range d.Value {
+				if token.Type == css.Ident || token.Type == css.String {
+					p.animations[token.Value] = true
+				}
+			}
+		}
+	}
+}
+
+// collectFonts records every string and every run of identifiers of the
+// value as a font family name, which covers font-family lists, the family
+// names at the end of the font shorthand and var() fallbacks.
+func collectFonts(value []css.Token, fonts map[string]bool) {
+	run := make([]string, 0)
+	flush := func() {
+		if len(run) > 0 {
+			fonts[strings.ToLower(strings.Join(run, " "))] = true
+			run = run[:0]
+		}
+	}
+	for _, token := range value {
+		switch token.Type {
+		case css.Ident:
+			run = append(run, token.Value)
+		case css.Whitespace, css.Comment:
+		case css.String:
+			flush()
+			fonts[strings.ToLower(token.Value)] = true
+		default:
+			flush()
+		}
+	}
+	flush()
+}
+
+func familyName(value []css.Token) string {
+	value = css.Trim(value)
+	if len(value) == 1 && value[0].Type == css.String {
+		return strings.ToLower(value[0].Value)
+	}
+	names := make([]string, 0, len(value))
+	for _, token := range value {
+		if token.Type == css.Ident {
+			names = append(names, token.Value)
+		}
+	}
+	return strings.ToLower(strings.Join(names, " "))
+}
@@ -0,0 +1,78 @@
+package transform_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestPruneStyles(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><head><style>
+@font-face { font-family: "Used Sans"; src: url(data:font/woff2;base64,AA==) }
+@font-face { font-family: Unused; src: url(data:font/woff2;base64,AA==) }
+@font-face { font-family: Inline; src: url(data:font/woff2;base64,AA==) }
+@keyframes spin { to { transform: rotate(1turn) } }
+@keyframes fade { to { opacity: 0 } }
+@font-face { font-family: Nested; src: url(data:font/woff2;base64,AA==) }
+@keyframes pulse { to { opacity: 0 } }
+.spinner { .title { font-family: Nested } &:hover { animation: pulse 1s } }
+@media screen { .spinner { @media (min-width: 1px) { color: red; .title { font-family: Nested } } } }
+p { font: 12px/1.5 "Used Sans", sans-serif }
+.missing { animation: fade 1s }
+a:hover { color: red }
+[aria-expanded=true] { display: block }
+@media print { .missing { color: blue } }
+@media screen { .spinner { animation: spin 1s } }
+@layer base { .missing { margin: 0 } }
+</style></head><body><p>text <a href="/">link</a></p><div class="spinner" style="font-family: Inline"></div></body></html>`,
+	})
+	defer srv.Close()
+	tests := []struct {
+		mode     transform.PruneMode
+		expected string
+	}{
+		{
+			transform.PruneConservative,
+			`@font-face { font-family: "Used Sans"; src: url(data:font/woff2;base64,AA==) }
+@font-face { font-family: Inline; src: url(data:font/woff2;base64,AA==) }
+@keyframes spin { to { transform: rotate(1turn) } }
+@font-face { font-family: Nested; src: url(data:font/woff2;base64,AA==) }
+@keyframes pulse { to { opacity: 0 } }
+.spinner { .title { font-family: Nested } &:hover { animation: pulse 1s } }
+@media screen { .spinner { @media (min-width: 1px) { color: red; .title { font-family: Nested } } } }
+p { font: 12px/1.5 "Used Sans", sans-serif }
+a:hover { color: red }
+[aria-expanded=true] { display: block }
+@media screen { .spinner { animation: spin 1s } }
+@layer base;
+`,
+		},
+		{
+			transform.PruneStrict,
+			`@font-face { font-family: "Used Sans"; src: url(data:font/woff2;base64,AA==) }
+@font-face { font-family: Inline; src: url(data:font/woff2;base64,AA==) }
+@keyframes spin { to { transform: rotate(1turn) } }
+@font-face { font-family: Nested; src: url(data:font/woff2;base64,AA==) }
+@keyframes pulse { to { opacity: 0 } }
+.spinner { .title { font-family: Nested } &:hover { animation: pulse 1s } }
+@media screen { .spinner { @media (min-width: 1px) { color: red; .title { font-family: Nested } } } }
+p { font: 12px/1.5 "Used Sans", sans-serif }
+@media screen { .spinner { animation: spin 1s } }
+@layer base;
+`,
+		},
+	}
+	for _, test := range tests {
+		root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+			return []transform.Transformer{transform.PruneStyles(test.mode)}
+		})
+		style, err := root.Find(html.IsTag("style"))
+		bee.Nil(err)
+		bee.Equal(normalizeCSS(style.Text()), normalizeCSS(test.expected))
+	}
+}
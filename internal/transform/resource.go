@@ -0,0 +1,105 @@
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+
+	"github.com/danielrenes/htdl/internal/http"
+)
+
+// Resource describes a subresource which was inlined into the document or
+// skipped, along with the reason.
+type Resource struct {
+	URL         string `json:"url"`
+	MIMEType    string `json:"mimeType,omitempty"`
+	Size        int    `json:"size"`
+	SHA256      string `json:"sha256,omitempty"`
+	Transformer string `json:"transformer,omitempty"`
+	Skipped     string `json:"skipped,omitempty"`
+}
+
+// Saving is the number of bytes a transformer removed from the document.
+type Saving struct {
+	Transformer string `json:"transformer"`
+	Bytes       int    `json:"bytes"`
+}
+
+func (t *TransformerContext) Resources() []Resource {
+	return slices.Clone(t.resources)
+}
+
+// download returns the content of the link and records it as a resource,
+// once per link however many times it is inlined.
+func (t *TransformerContext) download(link string, mimeType string) ([]byte, error) {
+	resp, err := t.fetch(link)
+	if err != nil {
+		return nil, err
+	}
+	recorded := slices.ContainsFunc(t.resources, func(r Resource) bool {
+		return r.URL == link && len(r.Skipped) == 0
+	})
+	if !recorded {
+		t.resources = append(t.resources, Resource{
+			URL:         link,
+			MIMEType:    mimeType,
+			Size:        len(resp.Data),
+			SHA256:      t.hashes[link],
+			Transformer: t.transformer,
+		})
+	}
+	return resp.Data, nil
+}
+
+// fetch returns the cached response of the link, fetching it on the first
+// use. Responses with the same content share it, keyed by its SHA-256 hash.
+// Unlike download it does not record the link as a resource.
+func (t *TransformerContext) fetch(link string) (*http.Response, error) {
+	return t.fetchLimited(link, -1)
+}
+
+// fetchLimited returns the response of the link like fetch, but responses
+// larger than maxSize bytes are neither read in full nor cached, and fail
+// with http.ErrTooLarge. A cached response is returned whatever its size.
+func (t *TransformerContext) fetchLimited(link string, maxSize int) (*http.Response, error) {
+	if resp, ok := t.cache[link]; ok {
+		return resp, nil
+	}
+	resp, err := http.FetchLimited(link, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(resp.Data)
+	hash := hex.EncodeToString(sum[:])
+	if data, ok := t.contents[hash]; ok {
+		resp.Data = data
+	} else {
+		t.contents[hash] = resp.Data
+	}
+	t.cache[link] = resp
+	t.hashes[link] = hash
+	return resp, nil
+}
+
+func (t *TransformerContext) skip(link string, reason string) {
+	t.resources = append(t.resources, Resource{
+		URL:         link,
+		Transformer: t.transformer,
+		Skipped:     reason,
+	})
+}
+
+func (t *TransformerContext) Savings() []Saving {
+	return slices.Clone(t.savings)
+}
+
+func (t *TransformerContext) save(bytes int) {
+	idx := slices.IndexFunc(t.savings, func(s Saving) bool {
+		return s.Transformer == t.transformer
+	})
+	if idx < 0 {
+		t.savings = append(t.savings, Saving{Transformer: t.transformer})
+		idx = len(t.savings) - 1
+	}
+	t.savings[idx].Bytes += bytes
+}
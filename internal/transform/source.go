@@ -0,0 +1,255 @@
+package transform
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/css"
+)
+
+var DefaultFontFormats = []string{"woff2", "woff", "truetype", "opentype", "embedded-opentype", "svg"}
+
+var fontExtensions = map[string]string{
+	".woff2": "woff2",
+	".woff":  "woff",
+	".ttf":   "truetype",
+	".otf":   "opentype",
+	".eot":   "embedded-opentype",
+	".svg":   "svg",
+}
+
+type sourceSelector struct {
+	ctx      *TransformerContext
+	sheetURL *url.URL
+	opts     StyleOptions
+}
+
+// selectSources keeps only the preferred source of the @font-face src
+// descriptors and the selected candidate of the image-set() functions of
+// the stylesheet, so the alternatives are not inlined.
+func selectSources(ctx *TransformerContext, sheetURL *url.URL, style string, opts StyleOptions) (string, error) {
+	s := &sourceSelector{ctx: ctx, sheetURL: sheetURL, opts: opts.withDefaults()}
+	sheet := css.Parse(style)
+	if err := s.selectFontSources(sheet.Rules); err != nil {
+		return "", err
+	}
+	tokens, err := s.selectImageSets(sheet.Tokens())
+	if err != nil {
+		return "", err
+	}
+	return css.Serialize(tokens), nil
+}
+
+func (s *sourceSelector) selectFontSources(rules []*css.Rule) error {
+	for _, rule := range rules {
+		switch {
+		case !rule.HasBlock:
+		case rule.Is("font-face"):
+			block, err := s.selectFontSource(rule.Block)
+			if err != nil {
+				return err
+			}
+			rule.Block = block
+		case slices.ContainsFunc(groupRules, rule.Is):
+			nested := css.ParseRules(rule.Block)
+			if err := s.selectFontSources(nested.Rules); err != nil {
+				return err
+			}
+			rule.Block = nested.Tokens()
+		}
+	}
+	return nil
+}
+
+// selectFontSource rewrites the block of a @font-face rule to keep only
+// the last src descriptor, which is the one in effect, with its local()
+// sources and the url() source of the most preferred format.
+func (s *sourceSelector) selectFontSource(block []css.Token) ([]css.Token, error) {
+	declarations := css.ParseDeclarations(block)
+	last := -1
+	sources := 0
+	for i, d := range declarations {
+		if d.Is("src") {
+			last = i
+			sources++
+		}
+	}
+	if last < 0 {
+		return block, nil
+	}
+	entries := css.SplitCommas(declarations[last].Value)
+	selected, rank := -1, 0
+	urls := 0
+	for i, entry := range entries {
+		if len(entryURLs(entry)) == 0 {
+			continue
+		}
+		urls++
+		if r := s.fontRank(entry); selected < 0 || r < rank {
+			selected, rank = i, r
+		}
+	}
+	if sources == 1 && urls <= 1 {
+		return block, nil
+	}
+	sb := strings.Builder{}
+	for i, d := range declarations {
+		if !d.Is("src") {
+			_, _ = sb.WriteString(serializeDeclaration(d))
+			continue
+		}
+		if i != last {
+			if err := s.skip(d.Value, "overridden @font-face src"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		kept := make([]string, 0, len(entries))
+		for j, entry := range entries {
+			if j != selected && len(entryURLs(entry)) > 0 {
+				if err := s.skip(entry, "not the preferred font format"); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			kept = append(kept, css.Serialize(entry))
+		}
+		_, _ = sb.WriteString(serializeDeclaration(&css.Declaration{
+			Name:      d.Name,
+			Value:     css.Tokenize(strings.Join(kept, ", ")),
+			Important: d.Important,
+		}))
+	}
+	_, _ = sb.WriteString(" ")
+	return css.Tokenize(sb.String()), nil
+}
+
+// fontRank returns the position of the format of the source in the
+// preferred formats, taken from its format() hint or the extension of its
+// URL.
+func (s *sourceSelector) fontRank(entry []css.Token) int {
+	format := ""
+	for i, token := range entry {
+		if token.Is(css.Function, "format") {
+			args, _ := functionArgs(entry, i)
+			if len(args) > 0 {
+				format = strings.ToLower(args[0].Value)
+			}
+		}
+	}
+	if len(format) == 0 {
+		if ref, err := url.Parse(entryURLs(entry)[0]); err == nil {
+			format = fontExtensions[strings.ToLower(path.Ext(ref.Path))]
+		}
+	}
+	if rank := slices.Index(s.opts.FontFormats, format); rank >= 0 {
+		return rank
+	}
+	return len(s.opts.FontFormats)
+}
+
+// selectImageSets keeps only the selected candidate of every image-set()
+// function. String candidates are turned into url() references so they
+// are inlined like the other references.
+func (s *sourceSelector) selectImageSets(tokens []css.Token) ([]css.Token, error) {
+	selected := make([]css.Token, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		selected = append(selected, token)
+		if !token.Is(css.Function, "image-set") && !token.Is(css.Function, "-webkit-image-set") {
+			continue
+		}
+		args, end := functionArgs(tokens, i)
+		candidates := css.SplitCommas(args)
+		best := -1
+		densities := make([]float64, len(candidates))
+		for j, candidate := range candidates {
+			densities[j] = candidateDensity(candidate)
+			if best < 0 || s.preferDensity(densities[j], densities[best]) {
+				best = j
+			}
+		}
+		for j, candidate := range candidates {
+			if j == best {
+				continue
+			}
+			if err := s.skip(candidate, "not the selected image-set candidate"); err != nil {
+				return nil, err
+			}
+		}
+		candidate := slices.Clone(candidates[best])
+		if len(candidate) > 0 && candidate[0].Type == css.String {
+			candidate[0] = css.NewURL(candidate[0].Value)
+		}
+		slog.Debug("Select image-set candidate", slog.Float64("density", densities[best]))
+		selected = append(selected, candidate...)
+		if end < len(tokens) {
+			selected = append(selected, tokens[end])
+		}
+		i = end
+	}
+	return selected, nil
+}
+
+// preferDensity reports whether density a is preferred over density b.
+func (s *sourceSelector) preferDensity(a, b float64) bool {
+	return preferAtLeast(a, b, s.opts.ImageSetDensity)
+}
+
+func candidateDensity(candidate []css.Token) float64 {
+	for _, token := range candidate {
+		if token.Type != css.Dimension {
+			continue
+		}
+		switch strings.ToLower(token.Unit) {
+		case "x", "dppx":
+			return token.Number
+		case "dpi":
+			return token.Number / 96
+		case "dpcm":
+			return token.Number * 2.54 / 96
+		}
+	}
+	return 1
+}
+
+// entryURLs returns the URLs a source or a candidate references, either as
+// url() or, in image-set(), as a string.
+func entryURLs(entry []css.Token) []string {
+	urls := make([]string, 0)
+	_, _ = css.RewriteURLs(entry, func(link string) (string, error) {
+		urls = append(urls, link)
+		return link, nil
+	})
+	if len(entry) > 0 && entry[0].Type == css.String {
+		urls = append(urls, entry[0].Value)
+	}
+	return urls
+}
+
+func (s *sourceSelector) skip(entry []css.Token, reason string) error {
+	for _, link := range entryURLs(entry) {
+		if len(link) == 0 || strings.HasPrefix(link, "data:") || strings.HasPrefix(link, "#") {
+			continue
+		}
+		resolved, err := resolveRef(s.sheetURL, link)
+		if err != nil {
+			return err
+		}
+		slog.Debug("Skip source", slog.String("href", resolved), slog.String("reason", reason))
+		s.ctx.skip(resolved, reason)
+	}
+	return nil
+}
+
+func serializeDeclaration(d *css.Declaration) string {
+	important := ""
+	if d.Important {
+		important = " !important"
+	}
+	return fmt.Sprintf(" %s: %s%s;", d.Name, css.Serialize(d.Value), important)
+}
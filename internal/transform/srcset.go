@@ -0,0 +1,246 @@
+package transform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/css"
+)
+
+// imageCandidate is an image candidate string of a srcset attribute. A zero
+// width means the candidate has no width descriptor.
+type imageCandidate struct {
+	url        string
+	descriptor string
+	width      float64
+	density    float64
+}
+
+// parseSrcset parses the srcset attribute following the algorithm of the
+// HTML standard, which allows commas in the URLs. Candidates with invalid
+// descriptors are dropped.
+func parseSrcset(srcset string) []imageCandidate {
+	candidates := make([]imageCandidate, 0)
+	isSpace := func(r rune) bool { return strings.ContainsRune(" \t\n\f\r", r) }
+	runes := []rune(srcset)
+	i := 0
+	for {
+		for i < len(runes) && (isSpace(runes[i]) || runes[i] == ',') {
+			i++
+		}
+		if i >= len(runes) {
+			return candidates
+		}
+		start := i
+		for i < len(runes) && !isSpace(runes[i]) {
+			i++
+		}
+		link := string(runes[start:i])
+		descriptors := make([]string, 0)
+		if trimmed := strings.TrimRight(link, ","); len(trimmed) < len(link) {
+			link = trimmed
+		} else {
+			descriptors, i = tokenizeDescriptors(runes, i, isSpace)
+		}
+		if candidate, ok := newImageCandidate(link, descriptors); ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+}
+
+// tokenizeDescriptors splits the descriptors of a candidate starting at
+// runes[i] on whitespace outside of parentheses, up to the comma ending
+// the candidate, and returns the index after it.
+func tokenizeDescriptors(runes []rune, i int, isSpace func(rune) bool) ([]string, int) {
+	descriptors := make([]string, 0)
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			descriptors = append(descriptors, current.String())
+			current.Reset()
+		}
+	}
+	parens := false
+	for ; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case parens:
+			current.WriteRune(r)
+			parens = r != ')'
+		case isSpace(r):
+			flush()
+		case r == ',':
+			flush()
+			return descriptors, i + 1
+		case r == '(':
+			current.WriteRune(r)
+			parens = true
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return descriptors, i
+}
+
+func newImageCandidate(link string, descriptors []string) (imageCandidate, bool) {
+	candidate := imageCandidate{url: link, descriptor: strings.Join(descriptors, " ")}
+	height := false
+	for _, d := range descriptors {
+		value, unit := d[:len(d)-1], d[len(d)-1:]
+		switch unit {
+		case "w":
+			w, err := strconv.Atoi(value)
+			if err != nil || w <= 0 || candidate.width > 0 || candidate.density > 0 || strings.HasPrefix(value, "+") {
+				return candidate, false
+			}
+			candidate.width = float64(w)
+		case "x":
+			x, err := strconv.ParseFloat(value, 64)
+			if err != nil || x < 0 || candidate.width > 0 || candidate.density > 0 || height ||
+				strings.ContainsAny(value, "+iInN") {
+				return candidate, false
+			}
+			candidate.density = x
+		case "h":
+			h, err := strconv.Atoi(value)
+			if err != nil || h <= 0 || height || candidate.density > 0 {
+				return candidate, false
+			}
+			height = true
+		default:
+			return candidate, false
+		}
+	}
+	if height && candidate.width == 0 {
+		return candidate, false
+	}
+	if candidate.width == 0 && candidate.density == 0 {
+		candidate.density = 1
+	}
+	return candidate, true
+}
+
+// serializeSrcset serializes the candidates into a srcset attribute.
+func serializeSrcset(candidates []imageCandidate) string {
+	parts := make([]string, len(candidates))
+	for i, c := range candidates {
+		parts[i] = c.url
+		if len(c.descriptor) > 0 {
+			parts[i] += " " + c.descriptor
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseSizes returns the source size in pixels the sizes attribute selects
+// for the viewport. Entries with media conditions or lengths which cannot
+// be evaluated are skipped, and 100vw is used if no entry applies.
+func parseSizes(sizes string) float64 {
+	for _, entry := range css.SplitCommas(css.Tokenize(sizes)) {
+		entry = css.Trim(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		last := entry[len(entry)-1]
+		if last.Is(css.Ident, "auto") {
+			return viewportWidth
+		}
+		size, ok := evalLength(last)
+		if !ok {
+			continue
+		}
+		if condition := css.Trim(entry[:len(entry)-1]); len(condition) == 0 || evalMediaCondition(condition) {
+			return size
+		}
+	}
+	return viewportWidth
+}
+
+type CandidateMode int
+
+const (
+	// CandidateLargest selects the candidate with the highest density.
+	CandidateLargest CandidateMode = iota
+	// CandidateSmallest selects the candidate with the lowest density.
+	CandidateSmallest
+	// CandidateWidth selects the narrowest candidate at least as wide as
+	// the target width, or the widest one.
+	CandidateWidth
+	// CandidateDensity selects the candidate with the lowest density not
+	// below the target density, or the highest one.
+	CandidateDensity
+)
+
+// CandidatePolicy selects the srcset candidate to inline.
+type CandidatePolicy struct {
+	Mode CandidateMode
+	// Target is the width in pixels for CandidateWidth and the density for
+	// CandidateDensity.
+	Target float64
+}
+
+// ParseCandidatePolicy parses largest, smallest, a width like 640w or a
+// density like 2x.
+func ParseCandidatePolicy(s string) (CandidatePolicy, error) {
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case "largest":
+		return CandidatePolicy{Mode: CandidateLargest}, nil
+	case "smallest":
+		return CandidatePolicy{Mode: CandidateSmallest}, nil
+	}
+	if len(s) > 1 {
+		target, err := strconv.ParseFloat(s[:len(s)-1], 64)
+		if err == nil && target > 0 {
+			switch s[len(s)-1] {
+			case 'w':
+				return CandidatePolicy{Mode: CandidateWidth, Target: target}, nil
+			case 'x':
+				return CandidatePolicy{Mode: CandidateDensity, Target: target}, nil
+			}
+		}
+	}
+	return CandidatePolicy{}, fmt.Errorf("invalid image candidate policy %s", s)
+}
+
+func (p CandidatePolicy) String() string {
+	switch p.Mode {
+	case CandidateSmallest:
+		return "smallest"
+	case CandidateWidth:
+		return strconv.FormatFloat(p.Target, 'f', -1, 64) + "w"
+	case CandidateDensity:
+		return strconv.FormatFloat(p.Target, 'f', -1, 64) + "x"
+	default:
+		return "largest"
+	}
+}
+
+// prefer reports whether candidate a is preferred over candidate b, whose
+// densities and widths are resolved against the same source size.
+func (p CandidatePolicy) prefer(a, b imageCandidate) bool {
+	switch p.Mode {
+	case CandidateSmallest:
+		return a.density < b.density
+	case CandidateWidth:
+		return preferAtLeast(a.width, b.width, p.Target)
+	case CandidateDensity:
+		return preferAtLeast(a.density, b.density, p.Target)
+	default:
+		return a.density > b.density
+	}
+}
+
+// preferAtLeast reports whether a is preferred over b when the lowest value
+// not below the target is wanted, or the highest one if none reaches it.
+// A target of zero prefers the highest value.
+func preferAtLeast(a, b, target float64) bool {
+	if target <= 0 || (a < target && b < target) {
+		return a > b
+	}
+	if a >= target && b >= target {
+		return a < b
+	}
+	return a >= target
+}
@@ -2,109 +2,188 @@ package transform
 
 import (
 	"fmt"
-	"iter"
+	"log/slog"
 	"net/url"
+	"slices"
 	"strings"
-	"unicode"
-	"unicode/utf8"
 
+	"github.com/danielrenes/htdl/internal/css"
 	"github.com/danielrenes/htdl/internal/html"
-	"github.com/danielrenes/htdl/internal/http"
 )
 
-type inlineStylesKey struct{}
+type StylesheetPolicy int
 
-func InlineStyles(baseURL *url.URL) Transformer {
+const (
+	StylesheetDrop StylesheetPolicy = iota
+	StylesheetInline
+)
+
+func (p StylesheetPolicy) String() string {
+	switch p {
+	case StylesheetInline:
+		return "inline"
+	default:
+		return "drop"
+	}
+}
+
+type StyleOptions struct {
+	// MaxImportDepth limits how deep @import chains are followed, it
+	// defaults to DefaultMaxImportDepth.
+	MaxImportDepth int
+	// FontFormats is the order of preference of the @font-face source
+	// formats, it defaults to DefaultFontFormats. Only the most preferred
+	// source is inlined, local() sources are kept.
+	FontFormats []string
+	// ImageSetDensity selects the image-set() candidate with the lowest
+	// density not below it, or the highest density if it is zero or no
+	// candidate is dense enough.
+	ImageSetDensity float64
+	// Alternate is the policy for alternate stylesheets, which are inlined
+	// disabled to keep the preferred stylesheets in effect.
+	Alternate StylesheetPolicy
+	// Disabled is the policy for stylesheets with the disabled attribute.
+	Disabled StylesheetPolicy
+}
+
+func (o StyleOptions) withDefaults() StyleOptions {
+	if o.MaxImportDepth <= 0 {
+		o.MaxImportDepth = DefaultMaxImportDepth
+	}
+	if len(o.FontFormats) == 0 {
+		o.FontFormats = DefaultFontFormats
+	}
+	return o
+}
+
+// InlineStyles replaces every linked stylesheet in place with an equivalent
+// style element and inlines the @import rules and url() references of all
+// stylesheets, so the cascade order and media conditions are preserved.
+func InlineStyles(baseURL *url.URL, opts StyleOptions) Transformer {
+	opts = opts.withDefaults()
 	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
-		styles := strings.Builder{}
-		for style, err := range iterStyles(node) {
-			if err != nil {
-				return err
+		docURL := documentBaseURL(node, baseURL)
+		styleNodes := slices.Collect(node.FindAll(html.Or(
+			html.IsTag("style"),
+			html.And(html.IsTag("link"), html.HasToken("rel", "stylesheet")),
+		)))
+		for _, n := range styleNodes {
+			var err error
+			if n.Tag() == "style" {
+				err = inlineStyleElement(ctx, n, docURL, opts)
+			} else {
+				err = inlineLinkElement(ctx, n, docURL, opts)
 			}
-			style, err = inlineLinks(baseURL, style)
 			if err != nil {
 				return err
 			}
-			_, _ = fmt.Fprintln(&styles, style)
 		}
-		ctx.SetValue(inlineStylesKey{}, styles.String())
 		return nil
 	})
 }
 
-func AppendInlinedStyles() Transformer {
-	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
-		head, err := node.Find(html.IsTag("head"))
-		if err != nil {
-			return fmt.Errorf("find head element: %w", err)
-		}
-		styles := ctx.GetValue(inlineStylesKey{}).(string)
-		head.AppendChild(html.NewNode("style", nil, styles))
-		return nil
-	})
+func inlineStyleElement(ctx *TransformerContext, node *html.Node, docURL *url.URL, opts StyleOptions) error {
+	// The stack starts with the URL of the sheet, like for linked sheets, so
+	// importing the document itself is detected as a cycle.
+	style, err := inlineStylesheet(ctx, docURL, node.Text(), opts, []string{docURL.String()})
+	if err != nil {
+		return err
+	}
+	node.SetText(style)
+	return nil
 }
 
-func iterStyles(node *html.Node) iter.Seq2[string, error] {
-	return func(yield func(string, error) bool) {
-		for styleTag := range node.FindAll(html.IsTag("style")) {
-			if !yield(styleTag.Text(), nil) {
-				return
-			}
-		}
-		for linkTag := range node.FindAll(html.IsTag("link"), html.HasAttr("rel", "stylesheet")) {
-			if href, ok := linkTag.GetAttr("href"); ok {
-				cssData, err := http.Download(href)
-				if !yield(string(cssData), err) {
-					return
-				}
-			}
+func inlineLinkElement(ctx *TransformerContext, node *html.Node, docURL *url.URL, opts StyleOptions) error {
+	href, ok := node.GetAttr("href")
+	if !ok {
+		return nil
+	}
+	_, disabled := node.GetAttr("disabled")
+	// Untitled alternate stylesheets are not alternates but persistent ones.
+	title, _ := node.GetAttr("title")
+	alternate := html.HasToken("rel", "alternate").Eval(node) && len(strings.TrimSpace(title)) > 0
+	switch {
+	case alternate && opts.Alternate == StylesheetDrop:
+		slog.Debug("Drop alternate stylesheet", slog.String("href", href))
+		ctx.skip(href, "alternate stylesheet")
+		node.Remove()
+		return nil
+	case disabled && opts.Disabled == StylesheetDrop:
+		slog.Debug("Drop disabled stylesheet", slog.String("href", href))
+		ctx.skip(href, "disabled stylesheet")
+		node.Remove()
+		return nil
+	}
+	link, err := resolveRef(docURL, href)
+	if err != nil {
+		return err
+	}
+	sheetURL, err := url.Parse(link)
+	if err != nil {
+		return fmt.Errorf("parse URL from %s: %w", link, err)
+	}
+	cssData, err := ctx.download(link, "text/css")
+	if err != nil {
+		return err
+	}
+	style, err := inlineStylesheet(ctx, sheetURL, string(cssData), opts, []string{link})
+	if err != nil {
+		return err
+	}
+	attrs := make(map[string]string)
+	for _, name := range []string{"media", "title"} {
+		if v, ok := node.GetAttr(name); ok {
+			attrs[name] = v
 		}
 	}
+	if alternate || disabled {
+		// A titled style element could become the preferred stylesheet set
+		// and disable the others, so inlined alternates only keep media.
+		delete(attrs, "title")
+		attrs["media"] = "not all"
+	}
+	node.ReplaceWith(html.NewNode("style", attrs, style))
+	return nil
 }
 
-func inlineLinks(baseURL *url.URL, style string) (string, error) {
-	var (
-		search = []rune("url(")
-		char   rune
-		size   int
-		match  int
-		arg    strings.Builder
-		sb     strings.Builder
-	)
-	for i := 0; i < len(style); i += size {
-		char, size = utf8.DecodeRuneInString(style[i:])
-		if char == unicode.ReplacementChar {
-			continue
+// inlineStylesheet selects the preferred font and image sources, expands
+// the @import rules and inlines the url() references of a stylesheet,
+// resolving them against the URL of the stylesheet.
+func inlineStylesheet(ctx *TransformerContext, sheetURL *url.URL, style string, opts StyleOptions, stack []string) (string, error) {
+	style, err := selectSources(ctx, sheetURL, style, opts)
+	if err != nil {
+		return "", err
+	}
+	style, err = expandImports(ctx, sheetURL, style, opts, stack)
+	if err != nil {
+		return "", err
+	}
+	return inlineLinks(ctx, sheetURL, style)
+}
+
+func inlineLinks(ctx *TransformerContext, baseURL *url.URL, style string) (string, error) {
+	tokens, err := css.RewriteURLs(css.Tokenize(style), func(link string) (string, error) {
+		if len(link) == 0 || strings.HasPrefix(link, "data:") || strings.HasPrefix(link, "#") {
+			return link, nil
 		}
-		if match < len(search) && char == search[match] {
-			_, _ = sb.WriteRune(char)
-			match++
-		} else if match == len(search) {
-			if char != ')' {
-				_, _ = arg.WriteRune(char)
-			} else {
-				link := strings.Trim(arg.String(), `'"`)
-				if strings.HasPrefix(link, "data:") {
-					_, _ = sb.WriteString(link)
-				} else {
-					url, err := resolveRef(baseURL, link)
-					if err != nil {
-						return "", err
-					}
-					newSrc, err := downloadAndBase64Encode(url)
-					if err != nil {
-						return "", err
-					}
-					_, _ = fmt.Fprintf(&sb, "%s)", newSrc)
-				}
-				match = 0
-				arg.Reset()
-			}
-		} else {
-			match = 0
-			arg.Reset()
-			_, _ = sb.WriteRune(char)
+		url, err := resolveRef(baseURL, link)
+		if err != nil {
+			return "", err
+		}
+		// The fragment selects an element of an SVG document, it is kept on
+		// the data URL but is not part of the downloaded resource.
+		url, fragment, hasFragment := strings.Cut(url, "#")
+		data, err := downloadAndBase64Encode(ctx, url)
+		if err != nil {
+			return "", err
 		}
+		if hasFragment {
+			data += "#" + fragment
+		}
+		return data, nil
+	})
+	if err != nil {
+		return "", err
 	}
-	return sb.String(), nil
+	return css.Serialize(tokens), nil
 }
@@ -0,0 +1,285 @@
+package transform_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestInlineStylesImports(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html":    `<html><head><link rel="stylesheet" href="/css/main.css"></head><body></body></html>`,
+		"/css/main.css":  `@charset "utf-8"; @import "/css/base.css"; @import url(/css/print.css) print; @import url("/css/grid.css") supports(display: grid) screen and (min-width: 10px); @import "/css/layer.css" layer(base); .main { color: red }`,
+		"/css/base.css":  `@charset "utf-8"; @import url(cycle.css); .base { color: blue }`,
+		"/css/cycle.css": `@import "base.css"; .cycle { color: blue }`,
+		"/css/print.css": `.print { color: black }`,
+		"/css/grid.css":  `.grid { display: grid }`,
+		"/css/layer.css": `.layer { color: green }`,
+	})
+	defer srv.Close()
+	style := inlineStyles(bee, srv.URL+"/index.html", transform.StyleOptions{})
+	expected := `@charset "utf-8";
+.cycle { color: blue }
+.base { color: blue }
+@media print { .print { color: black } }
+@media screen and (min-width: 10px) { @supports (display: grid) { .grid { display: grid } } }
+@layer base { .layer { color: green } }
+.main { color: red }`
+	bee.Equal(normalizeCSS(style), normalizeCSS(expected))
+}
+
+func TestInlineStylesImportDepth(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><head><style>@import "a.css"; .index { color: red }</style></head><body></body></html>`,
+		"/a.css":      `@import "b.css"; .a { color: red }`,
+		"/b.css":      `@import "c.css"; .b { color: red }`,
+		"/c.css":      `.c { color: red }`,
+	})
+	defer srv.Close()
+	style := inlineStyles(bee, srv.URL+"/index.html", transform.StyleOptions{MaxImportDepth: 2})
+	bee.Equal(normalizeCSS(style), normalizeCSS(`.b { color: red } .a { color: red } .index { color: red }`))
+}
+
+func TestInlineStylesImportSelf(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><head><style>@import url(index.html); .index { color: red }</style></head><body></body></html>`,
+	})
+	defer srv.Close()
+	style := inlineStyles(bee, srv.URL+"/index.html", transform.StyleOptions{})
+	bee.Equal(normalizeCSS(style), normalizeCSS(`.index { color: red }`))
+}
+
+func TestInlineStylesRelativeURLs(t *testing.T) {
+	bee := bee.New(t)
+	cdn := newServer(map[string]string{
+		"/lib/1.0/css/lib.css":        `@import "theme/dark.css"; .lib { background: url(../img/bg.png) }`,
+		"/lib/1.0/css/theme/dark.css": `.dark { background: url("../../img/dark.png") }`,
+		"/lib/1.0/img/bg.png":         "bg",
+		"/lib/1.0/img/dark.png":       "dark",
+	})
+	defer cdn.Close()
+	srv := newServer(map[string]string{
+		"/blog/post/index.html": `<html><head>
+<base href="/static/">
+<link rel="stylesheet" href="css/site.css">
+<link rel="stylesheet" href="` + cdn.URL + `/lib/1.0/css/lib.css">
+<style>.inline { background: url(img/inline.png) }</style>
+</head><body></body></html>`,
+		"/static/css/site.css":   `@font-face { font-family: F; src: url(../fonts/x.woff2) format("woff2") }`,
+		"/static/fonts/x.woff2":  "font",
+		"/static/img/inline.png": "inline",
+	})
+	defer srv.Close()
+	style := inlineStyles(bee, srv.URL+"/blog/post/index.html", transform.StyleOptions{})
+	expected := `@font-face { font-family: F; src: url("data:font/woff2;base64,Zm9udA==") format("woff2") }
+.dark { background: url("data:image/png;base64,ZGFyaw==") }
+.lib { background: url("data:image/png;base64,Ymc=") }
+.inline { background: url("data:image/png;base64,aW5saW5l") }`
+	bee.Equal(normalizeCSS(style), normalizeCSS(expected))
+}
+
+func TestInlineStylesInPlace(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><head>
+<style>.a { color: red }</style>
+<link rel="stylesheet" href="b.css" media="print" title="Default">
+<link rel="alternate stylesheet" href="c.css" title="Dark">
+<link rel="alternate stylesheet" href="f.css" media="screen">
+<link rel="stylesheet" href="d.css" disabled>
+<link rel="icon" href="icon.png">
+</head><body><style media="(prefers-color-scheme: dark)">.e { color: white }</style><p>text</p></body></html>`,
+		"/b.css": `.b { color: blue }`,
+		"/c.css": `.c { color: black }`,
+		"/d.css": `.d { color: green }`,
+		"/f.css": `.f { color: gray }`,
+	})
+	defer srv.Close()
+	tests := []struct {
+		opts     transform.StyleOptions
+		expected string
+	}{
+		{
+			transform.StyleOptions{},
+			`<head>
+<style>.a { color: red }</style>
+<style media="print" title="Default">.b { color: blue }</style>
+
+<style media="screen">.f { color: gray }</style>
+
+<link rel="icon" href="%[1]s/icon.png"/>
+</head><body><style media="(prefers-color-scheme: dark)">.e { color: white }</style><p>text</p></body>`,
+		},
+		{
+			transform.StyleOptions{Alternate: transform.StylesheetInline, Disabled: transform.StylesheetInline},
+			`<head>
+<style>.a { color: red }</style>
+<style media="print" title="Default">.b { color: blue }</style>
+<style media="not all">.c { color: black }</style>
+<style media="screen">.f { color: gray }</style>
+<style media="not all">.d { color: green }</style>
+<link rel="icon" href="%[1]s/icon.png"/>
+</head><body><style media="(prefers-color-scheme: dark)">.e { color: white }</style><p>text</p></body>`,
+		},
+	}
+	for _, test := range tests {
+		root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+			return []transform.Transformer{transform.ResolveLinks(baseURL), transform.InlineStyles(baseURL, test.opts)}
+		})
+		doc, err := root.Find(html.IsTag("html"))
+		bee.Nil(err)
+		bee.Equal(doc.RenderString(), fmt.Sprintf("<html>%s</html>", fmt.Sprintf(test.expected, srv.URL)))
+	}
+}
+
+func TestInlineStyleAttributes(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><head><base href="/static/"></head><body>
+<div style="background-image: url(hero.png); color: red"></div>
+<table background="bg.png"><tr><td background="data:image/png;base64,AA==">cell</td></tr></table>
+<div background="bg.png"></div>
+<svg><rect fill="url(#local)" stroke="url('paint.svg#grad')"/></svg>
+</body></html>`,
+		"/static/hero.png":  "hero",
+		"/static/bg.png":    "bg",
+		"/static/paint.svg": "paint",
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.InlineStyleAttributes(baseURL, transform.StyleOptions{})}
+	})
+	body, err := root.Find(html.IsTag("body"))
+	bee.Nil(err)
+	expected := fmt.Sprintf(`<body>
+<div style="background-image: url(&#34;data:image/png;base64,%s&#34;); color: red"></div>
+<table background="data:image/png;base64,%s"><tbody><tr><td background="data:image/png;base64,AA==">cell</td></tr></tbody></table>
+<div background="bg.png"></div>
+<svg><rect fill="url(#local)" stroke="url(&#39;data:image/svg+xml;base64,%s#grad&#39;)"></rect></svg>
+</body>`,
+		base64.StdEncoding.EncodeToString([]byte("hero")),
+		base64.StdEncoding.EncodeToString([]byte("bg")),
+		base64.StdEncoding.EncodeToString([]byte("paint")),
+	)
+	bee.Equal(body.RenderString(), expected)
+}
+
+func TestMinifyStyles(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><head>
+<style>
+@font-face { font-family: F; src: url(data:font/woff2;base64,AA==) }
+p { color: #FFFFFF }
+</style>
+<style>@font-face { font-family: F; src: url(data:font/woff2;base64,AA==) } a { margin: 0px }</style>
+<style>@font-face { font-family: G; src: url(data:font/woff2;base64,AA==) }</style>
+<style>@font-face { font-family: G; src: url(data:font/woff2;base64,AA==) } b { margin: 0px }</style>
+<style media="print">@font-face { font-family: F; src: url(data:font/woff2;base64,AA==) }</style>
+</head><body></body></html>`,
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.MinifyStyles()}
+	})
+	styles := make([]string, 0)
+	for style := range root.FindAll(html.IsTag("style")) {
+		styles = append(styles, style.Text())
+	}
+	bee.Equal(strings.Join(styles, "\n"), `@font-face{font-family:F;src:url(data:font/woff2;base64,AA==)}p{color:#fff}
+@font-face{font-family:F;src:url(data:font/woff2;base64,AA==)}a{margin:0}
+@font-face{font-family:G;src:url(data:font/woff2;base64,AA==)}
+b{margin:0}
+@font-face{font-family:F;src:url(data:font/woff2;base64,AA==)}`)
+}
+
+func TestInlineStylesSources(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><head><style>
+@font-face {
+  font-family: F;
+  src: url(f.eot);
+  src: url(f.eot?#iefix) format("embedded-opentype"), local("F"), url(f.woff) format("woff"), url(f.woff2) format("woff2"), url(f.ttf);
+}
+.hero { background-image: image-set("a.png" 1x, url(b.png) 2x, "c.png" 192dpi) }
+</style></head><body></body></html>`,
+		"/f.woff2": "woff2",
+		"/f.woff":  "woff",
+		"/f.ttf":   "ttf",
+		"/a.png":   "a",
+		"/b.png":   "b",
+	})
+	defer srv.Close()
+	tests := []struct {
+		opts     transform.StyleOptions
+		expected string
+	}{
+		{
+			transform.StyleOptions{},
+			`@font-face { font-family: F; src: local("F"), url("data:font/woff2;base64,d29mZjI=") format("woff2"); }
+.hero { background-image: image-set(url("data:image/png;base64,Yg==") 2x) }`,
+		},
+		{
+			transform.StyleOptions{FontFormats: []string{"truetype"}, ImageSetDensity: 1},
+			`@font-face { font-family: F; src: local("F"), url("data:font/ttf;base64,dHRm"); }
+.hero { background-image: image-set(url("data:image/png;base64,YQ==") 1x) }`,
+		},
+	}
+	for _, test := range tests {
+		bee.Equal(normalizeCSS(inlineStyles(bee, srv.URL+"/index.html", test.opts)), normalizeCSS(test.expected))
+	}
+}
+
+func inlineStyles(bee *bee.Bee, link string, opts transform.StyleOptions) string {
+	root := runPipeline(bee, link, func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.ResolveLinks(baseURL), transform.InlineStyles(baseURL, opts)}
+	})
+	styles := make([]string, 0)
+	for style := range root.FindAll(html.IsTag("style")) {
+		styles = append(styles, style.Text())
+	}
+	return strings.Join(styles, "\n")
+}
+
+func runPipeline(bee *bee.Bee, link string, transformers func(baseURL *url.URL) []transform.Transformer) *html.Node {
+	resp, err := http.Get(link)
+	bee.Nil(err)
+	defer resp.Body.Close()
+	root, err := html.Parse(resp.Body)
+	bee.Nil(err)
+	baseURL, err := url.Parse(link)
+	bee.Nil(err)
+	err = transform.NewPipeline(transformers(baseURL)...).Run(root)
+	bee.Nil(err)
+	return root
+}
+
+func newServer(files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(data))
+	}))
+}
+
+func normalizeCSS(s string) string {
+	s = regexp.MustCompile(`\s+`).ReplaceAllString(s, " ")
+	s = regexp.MustCompile(`\s*([{};])\s*`).ReplaceAllString(s, "$1")
+	return strings.TrimSpace(s)
+}
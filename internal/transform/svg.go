@@ -0,0 +1,311 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/danielrenes/htdl/internal/html"
+)
+
+// fragmentRef matches the url() references to fragments in attributes,
+// like fill="url(#gradient)".
+var fragmentRef = regexp.MustCompile(`url\(\s*['"]?#([^'")\s]+)['"]?\s*\)`)
+
+// spriteContainer hides the inlined sprite definitions without display:
+// none, which stops gradients and masks from rendering in some browsers.
+const spriteContainer = `<svg xmlns="http://www.w3.org/2000/svg" aria-hidden="true" ` +
+	`style="position: absolute; width: 0; height: 0; overflow: hidden"></svg>`
+
+// imgAttrs are the attributes of img elements kept on the svg elements
+// replacing them.
+var imgAttrs = []string{"id", "class", "style", "width", "height", "title"}
+
+type spriteInliner struct {
+	ctx       *TransformerContext
+	docURL    *url.URL
+	sprites   map[string]*html.Node
+	localIDs  map[string]string
+	usedIDs   map[string]bool
+	container *html.Node
+}
+
+// InlineSVG copies the elements external sprite files referenced by the
+// use elements define into a hidden svg element of the document, and
+// points the use elements to them, fetching every sprite file once. The
+// elements the copies reference, like gradients, are copied too, and
+// copies are renamed if their IDs are taken. If images is true, the img
+// elements with SVG sources are replaced with the svg elements first, with
+// their IDs renamed likewise. Images with style elements are kept, since
+// their rules would apply to the whole document.
+func InlineSVG(baseURL *url.URL, images bool) Transformer {
+	return TransformerFunc(func(node *html.Node, ctx *TransformerContext) error {
+		s := &spriteInliner{
+			ctx:      ctx,
+			docURL:   documentBaseURL(node, baseURL),
+			sprites:  make(map[string]*html.Node),
+			localIDs: make(map[string]string),
+			usedIDs:  make(map[string]bool),
+		}
+		for n := range node.FindAll(html.HasAttrFunc("id", func(string) bool { return true })) {
+			id, _ := n.GetAttr("id")
+			s.usedIDs[id] = true
+		}
+		if images {
+			imgs := slices.Collect(node.FindAll(html.IsTag("img"), html.HasAttrFunc("src", isSVGRef)))
+			for _, n := range imgs {
+				if err := s.inlineImage(n); err != nil {
+					return err
+				}
+			}
+		}
+		uses := slices.Collect(node.FindAll(html.IsTag("use"), html.HasAttrFunc("href", func(v string) bool {
+			v = strings.TrimSpace(v)
+			return len(v) > 0 && !strings.HasPrefix(v, "#")
+		})))
+		for _, n := range uses {
+			if err := s.inlineUse(node, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func isSVGRef(src string) bool {
+	src = strings.ToLower(strings.TrimSpace(src))
+	if i := strings.IndexAny(src, "?#"); i >= 0 {
+		src = src[:i]
+	}
+	return strings.HasSuffix(src, ".svg")
+}
+
+// inlineImage replaces the img element with the root svg element of its
+// source, keeping the attributes which apply to both and the alt text as
+// the accessible name. The IDs of the image are renamed to unique ones.
+func (s *spriteInliner) inlineImage(node *html.Node) error {
+	src, _ := node.GetAttr("src")
+	link, err := resolveRef(s.docURL, strings.TrimSpace(src))
+	if err != nil {
+		return err
+	}
+	doc, err := s.sprite(link)
+	if err != nil {
+		return err
+	}
+	root, err := doc.Find(html.IsTag("svg"))
+	if err != nil {
+		return fmt.Errorf("no svg element in %s", link)
+	}
+	if _, err := root.Find(html.IsTag("style")); err == nil {
+		slog.Debug("Keep SVG image with style element", slog.String("src", link))
+		return nil
+	}
+	svgURL, err := url.Parse(link)
+	if err != nil {
+		return fmt.Errorf("parse URL from %s: %w", link, err)
+	}
+	svg := root.Clone()
+	s.renameIDs(svg)
+	for use := range svg.FindAll(html.IsTag("use"), html.HasAttrFunc("href", func(v string) bool {
+		return !strings.HasPrefix(strings.TrimSpace(v), "#")
+	})) {
+		// The references of the image are relative to its source.
+		href, _ := use.GetAttr("href")
+		ref, err := resolveRef(svgURL, strings.TrimSpace(href))
+		if err != nil {
+			return err
+		}
+		use.ReplaceAttr("href", ref)
+	}
+	for _, name := range imgAttrs {
+		if v, ok := node.GetAttr(name); ok {
+			svg.DeleteAttr(name)
+			svg.SetAttr(name, v)
+		}
+	}
+	if alt, ok := node.GetAttr("alt"); ok {
+		if len(alt) > 0 {
+			svg.SetAttr("role", "img")
+			svg.SetAttr("aria-label", alt)
+		} else {
+			svg.SetAttr("aria-hidden", "true")
+		}
+	}
+	slog.Debug("Inline SVG image", slog.String("src", link))
+	node.ReplaceWith(svg)
+	return nil
+}
+
+func (s *spriteInliner) inlineUse(root *html.Node, node *html.Node) error {
+	href, _ := node.GetAttr("href")
+	link, err := resolveRef(s.docURL, strings.TrimSpace(href))
+	if err != nil {
+		return err
+	}
+	file, id, ok := strings.Cut(link, "#")
+	if !ok || len(id) == 0 {
+		return nil
+	}
+	localID, err := s.copyDefinition(root, file, id)
+	if err != nil {
+		return err
+	}
+	if len(localID) == 0 {
+		slog.Debug("Sprite definition not found", slog.String("href", link))
+		return nil
+	}
+	node.ReplaceAttr("href", "#"+localID)
+	return nil
+}
+
+// copyDefinition copies the element with the ID of the sprite file and the
+// elements it references into the container, and returns its local ID, or
+// an empty string if the sprite file has no such element.
+func (s *spriteInliner) copyDefinition(root *html.Node, file string, id string) (string, error) {
+	key := file + "#" + id
+	if localID, ok := s.localIDs[key]; ok {
+		return localID, nil
+	}
+	doc, err := s.sprite(file)
+	if err != nil {
+		return "", err
+	}
+	definition, err := doc.Find(html.HasAttr("id", id))
+	if err != nil {
+		return "", nil
+	}
+	localID := s.uniqueID(id)
+	s.localIDs[key] = localID
+	clone := definition.Clone()
+	clone.ReplaceAttr("id", localID)
+	if err := s.rewriteRefs(root, file, clone); err != nil {
+		return "", err
+	}
+	container, err := s.spriteContainer(root)
+	if err != nil {
+		return "", err
+	}
+	container.AppendChild(clone)
+	return localID, nil
+}
+
+// uniqueID returns the ID, or the ID with the lowest numeric suffix which
+// is not taken yet, and marks it taken.
+func (s *spriteInliner) uniqueID(id string) string {
+	localID := id
+	for i := 2; s.usedIDs[localID]; i++ {
+		localID = fmt.Sprintf("%s-%d", id, i)
+	}
+	s.usedIDs[localID] = true
+	return localID
+}
+
+// renameIDs gives the elements of the inlined image unique IDs and points
+// the references of the image to the renamed elements.
+func (s *spriteInliner) renameIDs(svg *html.Node) {
+	renamed := make(map[string]string)
+	for n := range svg.FindAll(html.HasAttrFunc("id", func(string) bool { return true })) {
+		id, _ := n.GetAttr("id")
+		if _, ok := renamed[id]; !ok {
+			renamed[id] = s.uniqueID(id)
+		}
+		n.ReplaceAttr("id", renamed[id])
+	}
+	for n := range svg.FindAll() {
+		for _, name := range n.AttrNames() {
+			value, _ := n.GetAttr(name)
+			rewritten := fragmentRef.ReplaceAllStringFunc(value, func(ref string) string {
+				if localID, ok := renamed[fragmentRef.FindStringSubmatch(ref)[1]]; ok {
+					return fmt.Sprintf("url(#%s)", localID)
+				}
+				return ref
+			})
+			if localID, ok := renamed[strings.TrimPrefix(value, "#")]; name == "href" && strings.HasPrefix(value, "#") && ok {
+				rewritten = "#" + localID
+			}
+			if rewritten != value {
+				n.ReplaceAttr(name, rewritten)
+			}
+		}
+	}
+}
+
+// rewriteRefs copies the elements of the sprite file the copied element
+// references and points the references to the copies.
+func (s *spriteInliner) rewriteRefs(root *html.Node, file string, node *html.Node) error {
+	for n := range node.FindAll() {
+		for _, name := range n.AttrNames() {
+			value, _ := n.GetAttr(name)
+			var rewriteErr error
+			rewritten := fragmentRef.ReplaceAllStringFunc(value, func(ref string) string {
+				localID, err := s.copyDefinition(root, file, fragmentRef.FindStringSubmatch(ref)[1])
+				if err != nil || len(localID) == 0 {
+					rewriteErr = err
+					return ref
+				}
+				return fmt.Sprintf("url(#%s)", localID)
+			})
+			if rewriteErr != nil {
+				return rewriteErr
+			}
+			if name == "href" && strings.HasPrefix(value, "#") {
+				localID, err := s.copyDefinition(root, file, value[1:])
+				if err != nil {
+					return err
+				}
+				if len(localID) > 0 {
+					rewritten = "#" + localID
+				}
+			}
+			if rewritten != value {
+				n.ReplaceAttr(name, rewritten)
+			}
+		}
+	}
+	return nil
+}
+
+// sprite returns the parsed SVG file, downloading it on the first use.
+func (s *spriteInliner) sprite(link string) (*html.Node, error) {
+	if doc, ok := s.sprites[link]; ok {
+		return doc, nil
+	}
+	data, err := s.ctx.download(link, "image/svg+xml")
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	s.sprites[link] = doc
+	return doc, nil
+}
+
+// spriteContainer returns the hidden svg element holding the copied
+// definitions, creating it as the first child of the body.
+func (s *spriteInliner) spriteContainer(root *html.Node) (*html.Node, error) {
+	if s.container != nil {
+		return s.container, nil
+	}
+	body, err := root.Find(html.IsTag("body"))
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := html.ParseFragment(spriteContainer, body)
+	if err != nil {
+		return nil, err
+	}
+	s.container = nodes[0]
+	if children := body.Children(); len(children) > 0 {
+		children[0].InsertBefore(s.container)
+	} else {
+		body.AppendChild(s.container)
+	}
+	return s.container, nil
+}
@@ -0,0 +1,73 @@
+package transform_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/danielrenes/bee"
+	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/transform"
+)
+
+func TestInlineSVG(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body><p id="icon-x">x</p>
+<svg><use href="/sprites.svg#icon-x"></use></svg>
+<svg><use xlink:href="sprites.svg#icon-y"></use></svg>
+<svg><use href="/sprites.svg#icon-x"></use></svg>
+<img src="/logo.svg" alt="Logo" class="logo">
+</body></html>`,
+		"/sprites.svg": `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg">
+<linearGradient id="g"><stop offset="0"/></linearGradient>
+<symbol id="icon-x" viewBox="0 0 10 10"><path fill="url(#g)" d="M0 0h10v10z"/></symbol>
+<symbol id="icon-y" viewBox="0 0 10 10"><circle r="5"/></symbol>
+<symbol id="unused"><circle r="1"/></symbol>
+</svg>`,
+		"/logo.svg": `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 1 1"><use href="sprites.svg#icon-y"/></svg>`,
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.InlineSVG(baseURL, true)}
+	})
+	body, err := root.Find(html.IsTag("body"))
+	bee.Nil(err)
+	bee.Equal(strings.Join(strings.Fields(body.RenderString()), " "), strings.Join(strings.Fields(`<body><svg xmlns="http://www.w3.org/2000/svg" aria-hidden="true" style="position: absolute; width: 0; height: 0; overflow: hidden">`+
+		`<linearGradient id="g"><stop offset="0"></stop></linearGradient>`+
+		`<symbol id="icon-x-2" viewBox="0 0 10 10"><path fill="url(#g)" d="M0 0h10v10z"></path></symbol>`+
+		`<symbol id="icon-y" viewBox="0 0 10 10"><circle r="5"></circle></symbol></svg><p id="icon-x">x</p>
+<svg><use href="#icon-x-2"></use></svg>
+<svg><use xlink:href="#icon-y"></use></svg>
+<svg><use href="#icon-x-2"></use></svg>
+<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 1 1" class="logo" role="img" aria-label="Logo"><use href="#icon-y"></use></svg>
+</body>`), " "))
+}
+
+func TestInlineSVGImageIDs(t *testing.T) {
+	bee := bee.New(t)
+	srv := newServer(map[string]string{
+		"/index.html": `<html><body><p id="g">g</p>
+<img src="/badge.svg">
+<img src="/badge.svg">
+<img src="/styled.svg">
+</body></html>`,
+		"/badge.svg": `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">` +
+			`<linearGradient id="g"><stop offset="0"/></linearGradient>` +
+			`<rect id="r" fill="url(#g)" width="1" height="1"/><use xlink:href="#r"/></svg>`,
+		"/styled.svg": `<svg xmlns="http://www.w3.org/2000/svg"><style>rect { fill: red }</style><rect width="1" height="1"/></svg>`,
+	})
+	defer srv.Close()
+	root := runPipeline(bee, srv.URL+"/index.html", func(baseURL *url.URL) []transform.Transformer {
+		return []transform.Transformer{transform.InlineSVG(baseURL, true)}
+	})
+	body, err := root.Find(html.IsTag("body"))
+	bee.Nil(err)
+	bee.Equal(strings.Join(strings.Fields(body.RenderString()), " "), strings.Join(strings.Fields(`<body><p id="g">g</p>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><linearGradient id="g-2"><stop offset="0"></stop></linearGradient>`+
+		`<rect id="r" fill="url(#g-2)" width="1" height="1"></rect><use xlink:href="#r"></use></svg>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><linearGradient id="g-3"><stop offset="0"></stop></linearGradient>`+
+		`<rect id="r-2" fill="url(#g-3)" width="1" height="1"></rect><use xlink:href="#r-2"></use></svg>
+<img src="/styled.svg"/>
+</body>`), " "))
+}
@@ -4,14 +4,30 @@ import (
 	"context"
 
 	"github.com/danielrenes/htdl/internal/html"
+	"github.com/danielrenes/htdl/internal/http"
 )
 
 type TransformerContext struct {
-	ctx context.Context
+	ctx         context.Context
+	transformer string
+	resources   []Resource
+	savings     []Saving
+	// cache holds the responses by URL, so every resource is fetched once.
+	cache map[string]*http.Response
+	// hashes holds the SHA-256 hashes of the cached responses by URL.
+	hashes map[string]string
+	// contents holds the contents of the cached responses by hash, so
+	// identical resources under different URLs are kept once.
+	contents map[string][]byte
 }
 
 func NewTransformerContext() *TransformerContext {
-	return &TransformerContext{ctx: context.Background()}
+	return &TransformerContext{
+		ctx:      context.Background(),
+		cache:    make(map[string]*http.Response),
+		hashes:   make(map[string]string),
+		contents: make(map[string][]byte),
+	}
 }
 
 func (t *TransformerContext) GetValue(key any) any {
@@ -3,6 +3,8 @@ package transform
 import (
 	"fmt"
 	"net/url"
+
+	"github.com/danielrenes/htdl/internal/html"
 )
 
 func resolveRef(base *url.URL, link string) (string, error) {
@@ -12,3 +14,21 @@ func resolveRef(base *url.URL, link string) (string, error) {
 	}
 	return base.ResolveReference(ref).String(), nil
 }
+
+// documentBaseURL returns the URL relative references in the document
+// resolve against, which is the href of the first base element if there is
+// one, or the URL of the page.
+func documentBaseURL(node *html.Node, pageURL *url.URL) *url.URL {
+	for base := range node.FindAll(html.IsTag("base")) {
+		href, ok := base.GetAttr("href")
+		if !ok {
+			continue
+		}
+		ref, err := url.Parse(href)
+		if err != nil {
+			return pageURL
+		}
+		return pageURL.ResolveReference(ref)
+	}
+	return pageURL
+}